@@ -26,10 +26,22 @@ import (
 	"github.com/thatpix3l/fntwo/pkg/config"
 	"github.com/thatpix3l/fntwo/pkg/obj"
 	"github.com/thatpix3l/fntwo/pkg/receivers"
-	"github.com/thatpix3l/fntwo/pkg/receivers/facemotion3d"
-	"github.com/thatpix3l/fntwo/pkg/receivers/mediapipeweb"
-	"github.com/thatpix3l/fntwo/pkg/receivers/virtualmotioncapture"
 	"github.com/thatpix3l/fntwo/pkg/router"
+	vmcsender "github.com/thatpix3l/fntwo/pkg/senders/virtualmotioncapture"
+
+	// Every type of receiver registers itself
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/bvh"
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/compositor"
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/facemotion3d"
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/failover"
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/idle"
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/ifacialmocap"
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/lipsync"
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/mediapipeweb"
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/openseeface"
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/replay"
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/virtualmotioncapture"
+	_ "github.com/thatpix3l/fntwo/pkg/receivers/vtubestudio"
 )
 
 var (
@@ -77,6 +89,28 @@ func saveDefaultScene(sceneFilePath string) error {
 				Y: 3,
 				Z: 3,
 			},
+			FOV: 50,
+		},
+		Light: obj.Light{
+			Position: obj.Position{
+				X: 1,
+				Y: 1,
+				Z: 1,
+			},
+			Rotation: obj.Rotation{
+				Quaternion: obj.QuaternionRotation{W: 1},
+			},
+			Color: obj.Color{
+				R: 1,
+				G: 1,
+				B: 1,
+				A: 1,
+			},
+		},
+		Compositor: config.Compositor{
+			Default:     "VirtualMotionCapture",
+			Bones:       make(map[string]string),
+			BlendShapes: make(map[string]string),
 		},
 	}
 
@@ -95,8 +129,46 @@ func saveDefaultScene(sceneFilePath string) error {
 
 }
 
-// Entrypoint
-func Start(appConfig *config.App) {
+// Create every receiver, by name.
+// Each registered type gets one instance named after itself, and configured instances are added on top.
+// A configured instance with the same name as a type replaces its default one.
+func buildReceivers(appConfig *config.App) (map[string]receivers.Receiver, error) {
+
+	receiverMap := make(map[string]receivers.Receiver)
+	env := receivers.Env{
+		AppConfig:   appConfig,
+		SceneConfig: sceneConfig,
+		Receivers:   receiverMap,
+	}
+
+	instances := make(map[string]config.ReceiverInstance)
+	for _, kind := range receivers.Types() {
+		instances[kind] = config.ReceiverInstance{
+			Name: kind,
+			Type: kind,
+		}
+	}
+	for _, instance := range appConfig.Receivers {
+		instances[instance.Name] = instance
+	}
+
+	for name, instance := range instances {
+
+		receiver, err := receivers.Build(env, instance)
+		if err != nil {
+			return nil, err
+		}
+
+		receiverMap[name] = receiver
+
+	}
+
+	return receiverMap, nil
+
+}
+
+// Entrypoint. Only returns if the app couldn't start, or the API server stopped.
+func Start(appConfig *config.App) error {
 
 	// If needed, create a default scene file
 	if err := saveDefaultScene(appConfig.SceneConfigPath); err != nil {
@@ -108,16 +180,28 @@ func Start(appConfig *config.App) {
 		log.Println(err)
 	}
 
-	// Create map of MotionReceiver
-	receiverMap := make(map[string]*receivers.MotionReceiver)
+	// Create map of receivers
+	receiverMap, err := buildReceivers(appConfig)
+	if err != nil {
+		return err
+	}
+
+	// Receiver picked by the user, which may be switched through the API
+	active, err := receivers.NewActive(receiverMap, appConfig.Receiver)
+	if err != nil {
+		return err
+	}
 
-	receiverMap["MediapipeWeb"] = mediapipeweb.New(appConfig)
-	receiverMap["VirtualMotionCapture"] = virtualmotioncapture.New(appConfig)
-	receiverMap["Facemotion3D"] = facemotion3d.New(appConfig)
+	// If any addresses were given, forward the active receiver's VRM data through VMC
+	if len(appConfig.VMCSend) > 0 {
+		if err := vmcsender.New(appConfig, active.Frame).Start(); err != nil {
+			return err
+		}
+	}
 
 	// Blocking listen and serve for WebSockets and API server
 	log.Printf("Serving API on %s", appConfig.APIListen)
-	routerAPI := router.New(appConfig, sceneConfig, receiverMap)
-	http.ListenAndServe(string(appConfig.APIListen), routerAPI)
+	routerAPI := router.New(appConfig, sceneConfig, receiverMap, active)
+	return http.ListenAndServe(string(appConfig.APIListen), routerAPI)
 
 }
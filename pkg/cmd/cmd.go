@@ -30,6 +30,8 @@ import (
 	"github.com/spf13/viper"
 	"github.com/thatpix3l/fntwo/pkg/app"
 	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/export"
+	"github.com/thatpix3l/fntwo/pkg/recorder"
 	"github.com/thatpix3l/fntwo/pkg/version"
 )
 
@@ -102,6 +104,16 @@ func initializeConfig(cmd *cobra.Command) {
 		envKey := envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
 		v.BindEnv(f.Name, envKey)
 
+		// Receivers may also be a list of objects in a config file, which can't be set like a flag
+		if f.Name == "receivers" && !f.Changed && v.IsSet(f.Name) {
+			if _, ok := v.Get(f.Name).(string); !ok {
+				if err := v.UnmarshalKey(f.Name, &appConfig.Receivers); err != nil {
+					log.Println(err)
+				}
+				return
+			}
+		}
+
 		// If command flag is not set and equivalent config key is set,
 		// assign to flag the config value
 		if !f.Changed && v.IsSet(f.Name) {
@@ -120,6 +132,10 @@ func newRootCommand() *cobra.Command {
 	// App config, with a few hardcoded default values
 	appConfig.VMCListen.Set("0.0.0.0:39540")
 	appConfig.FM3DListen.Set("0.0.0.0:49986")
+	appConfig.IFMListen.Set("0.0.0.0:49983")
+	appConfig.VTSListen.Set("0.0.0.0:50508")
+	appConfig.OSFListen.Set("0.0.0.0:11573")
+	appConfig.MPListen.Set("0.0.0.0:2332")
 	appConfig.APIListen.Set("127.0.0.1:3579")
 	appConfig.Receiver = "VirtualMotionProtocol"
 
@@ -137,6 +153,7 @@ func newRootCommand() *cobra.Command {
 			// Set values of app config keys that are dependent on command flags
 			appConfig.SceneConfigPath = path.Join(cmd.Flag("scene-home").Value.String(), "scene.json")
 			appConfig.VRMFilePath = path.Join(cmd.Flag("scene-home").Value.String(), "default.vrm")
+			appConfig.RecordingsDirPath = path.Join(cmd.Flag("scene-home").Value.String(), "recordings")
 
 			// Create scene home if not explicitly specified elsewhere
 			if !cmd.Flag("scene-home").Changed {
@@ -146,10 +163,14 @@ func newRootCommand() *cobra.Command {
 			}
 
 		},
-		Run: func(_ *cobra.Command, _ []string) {
+		RunE: func(cmd *cobra.Command, _ []string) error {
+
+			// Flags were fine by now, so errors from here on aren't about usage, and are logged once by Start
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
 
 			// Entrypoint for actual program
-			app.Start(appConfig)
+			return app.Start(appConfig)
 
 		},
 	}
@@ -158,13 +179,106 @@ func newRootCommand() *cobra.Command {
 	rootFlags := rootCmd.Flags()
 	rootFlags.StringVar(&appConfig.AppConfigPath, "config-app", cfgFileNoExt+".{json,yaml,toml,ini}", "Path to a config file.")
 	rootFlags.Var(&appConfig.VMCListen, "listen-vmc", "Address to listen on for VMC motion data")
+	rootFlags.Var(&appConfig.VMCSend, "send-vmc", "Address to send VMC motion data to. May be given multiple times, or as a comma-separated list")
+	rootFlags.IntVar(&appConfig.VMCSendFrequency, "send-vmc-frequency", 60, "Times per second VMC motion data is sent to each address")
+	rootFlags.BoolVar(&appConfig.VMCCamera, "vmc-camera", false, "Let VMC camera messages control the scene camera, ignoring camera writer clients")
 	rootFlags.Var(&appConfig.FM3DListen, "listen-fm3d", "Address to listen on for Facemotion3D motion data")
 	rootFlags.Var(&appConfig.FM3DDevice, "device-fm3d", "IP address of phone/device that is the source of Facemotion3D motion data")
+	rootFlags.Var(&appConfig.IFMListen, "listen-ifm", "Address to listen on for iFacialMocap motion data")
+	rootFlags.Var(&appConfig.IFMDevice, "device-ifm", "IP address of phone/device that is the source of iFacialMocap motion data")
+	rootFlags.Var(&appConfig.VTSListen, "listen-vts", "Address to listen on for VTube Studio motion data")
+	rootFlags.Var(&appConfig.VTSDevice, "device-vts", "IP address of phone/device that is the source of VTube Studio motion data")
+	rootFlags.Var(&appConfig.OSFListen, "listen-osf", "Address to listen on for OpenSeeFace motion data")
+	rootFlags.Var(&appConfig.MPListen, "listen-mediapipe", "Address to listen on for MediapipeWeb motion data, besides /live/write/mediapipe on the API server. Empty to disable")
+	rootFlags.StringVar(&appConfig.ReplayFile, "replay-file", "", "Recording for the Replay receiver to play back, either a name in the recordings directory or a path")
+	rootFlags.BoolVar(&appConfig.ReplayLoop, "replay-loop", true, "Start playback over once the recording ends")
+	rootFlags.Float64Var(&appConfig.ReplaySpeed, "replay-speed", 1, "How fast recordings are played back, where 1 is real-time")
+	rootFlags.StringVar(&appConfig.BVHFile, "bvh-file", "", "Path to a BVH motion capture file for the BVH receiver to play back")
+	rootFlags.Float64Var(&appConfig.BVHScale, "bvh-scale", 0.01, "Multiplier converting BVH units into meters. Most files are in centimeters")
+	rootFlags.BoolVar(&appConfig.BVHLoop, "bvh-loop", true, "Start BVH playback over once the motion ends")
+	rootFlags.Float64Var(&appConfig.IdleBreathRate, "idle-breath-rate", 14, "Breaths per minute of the Idle receiver")
+	rootFlags.Float64Var(&appConfig.IdleBreathDepth, "idle-breath-depth", 1.5, "Degrees the spine and chest bend when the Idle receiver breathes")
+	rootFlags.Float64Var(&appConfig.IdleBlinkInterval, "idle-blink-interval", 4, "Average seconds between blinks of the Idle receiver")
+	rootFlags.Float64Var(&appConfig.IdleSway, "idle-sway", 3, "Degrees the head sways around with the Idle receiver")
+	rootFlags.Float64Var(&appConfig.IdleSaccadeInterval, "idle-saccade-interval", 1.5, "Average seconds between eye movements of the Idle receiver")
+	rootFlags.Float64Var(&appConfig.IdleArmAngle, "idle-arm-angle", 70, "Degrees the Idle receiver lowers the arms from a T-pose")
+	rootFlags.StringVar(&appConfig.LipSyncWAV, "lipsync-wav", "", "Path to a WAV file for the LipSync receiver to play, instead of listening for audio on /live/write/audio")
+	rootFlags.Float64Var(&appConfig.LipSyncThreshold, "lipsync-threshold", -45, "Loudness in decibels below which the LipSync receiver keeps the mouth closed")
+	rootFlags.Float64Var(&appConfig.LipSyncSmoothing, "lipsync-smoothing", 0.5, "How much of the previous mouth shape the LipSync receiver keeps each update, from 0 to 1")
+	rootFlags.Var(&appConfig.Failover, "failover", "Receivers for the Failover receiver to pick from, most preferred first, e.g. Facemotion3D,MediapipeWeb,Idle. May be given multiple times, or as a comma-separated list")
+	rootFlags.Float64Var(&appConfig.FailoverTimeout, "failover-timeout", 1, "Seconds without data before the Failover receiver moves on to the next receiver")
+	rootFlags.Float64Var(&appConfig.FailoverCrossfade, "failover-crossfade", 0.5, "Seconds the Failover receiver takes to blend from one receiver to another")
 	rootFlags.Var(&appConfig.APIListen, "listen-api", "Address to listen on for API queries")
 	rootFlags.IntVar(&appConfig.ModelUpdateFrequency, "update-frequency", 60, "Times per second the live VRM model data is sent to each client")
 	rootFlags.StringVar(&appConfig.SceneDirPath, "scene-home", sceneDir, "Path to scene data home")
 	rootFlags.StringVar(&appConfig.Receiver, "receiver", "VirtualMotionCapture", "Name of a receiver to use as source of motion data")
+	rootFlags.Var(&appConfig.Receivers, "receivers", "Extra receivers to create, each formatted as name=type[@listen[@device]], e.g. vmc2=VirtualMotionCapture@0.0.0.0:39541. May be given multiple times, or as a comma-separated list")
+
+	rootCmd.AddCommand(newExportCommand())
 
 	return rootCmd
 
 }
+
+// Command for exporting motion recordings to animation files
+func newExportCommand() *cobra.Command {
+
+	var (
+		format    string // Name of format to export to
+		output    string // Path to exported file
+		sceneHome string // Path to scene directory, where recordings are looked up
+	)
+
+	exportCmd := &cobra.Command{
+		Use:   "export <recording>",
+		Short: "Export a motion recording to an animation file",
+		Long:  `Export a motion recording to an animation file, either BVH for most 3D software or VRM Animation for VRM models`,
+		Args:  cobra.ExactArgs(1),
+
+		// Exporting doesn't need any of the app config, so skip loading it
+		PersistentPreRun: func(_ *cobra.Command, _ []string) {},
+
+		RunE: func(_ *cobra.Command, args []string) error {
+
+			exportFormat, ok := export.Formats[format]
+			if !ok {
+				return fmt.Errorf("unknown export format \"%s\"", format)
+			}
+
+			// Recordings can be given by name, or by path
+			recordingPath := recorder.Resolve(path.Join(sceneHome, "recordings"), args[0])
+			recording, err := recorder.Open(recordingPath)
+			if err != nil {
+				return err
+			}
+
+			// By default, export next to the recording
+			if output == "" {
+				output = strings.TrimSuffix(recordingPath, recorder.Extension) + exportFormat.Extension
+			}
+
+			file, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			if err := exportFormat.Write(file, recording); err != nil {
+				return err
+			}
+
+			log.Printf("Exported %s to %s", recordingPath, output)
+
+			return nil
+
+		},
+	}
+
+	exportFlags := exportCmd.Flags()
+	exportFlags.StringVar(&format, "format", "bvh", "Format to export to, either \"bvh\" or \"vrma\"")
+	exportFlags.StringVarP(&output, "output", "o", "", "Path to exported file. Defaults to next to the recording")
+	exportFlags.StringVar(&sceneHome, "scene-home", sceneDir, "Path to scene data home, where recordings are looked up by name")
+
+	return exportCmd
+
+}
@@ -18,9 +18,12 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/thatpix3l/fntwo/pkg/obj"
 	"github.com/thatpix3l/fntwo/pkg/pool"
@@ -63,18 +66,188 @@ func (a *Address) Type() string {
 	return "address"
 }
 
+// List of addresses
+type Addresses []Address
+
+// Return comma-separated string of all addresses
+func (a *Addresses) String() string {
+
+	var addresses []string
+	for _, address := range *a {
+		addresses = append(addresses, address.String())
+	}
+
+	return strings.Join(addresses, ",")
+
+}
+
+// Setter, mainly used for cobra.
+// Accepts one or more addresses, separated by commas or spaces
+func (a *Addresses) Set(v string) error {
+
+	// Config files and env variables may give us something like "[a b]" or "a,b"
+	fields := strings.FieldsFunc(v, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '[' || r == ']'
+	})
+
+	for _, field := range fields {
+		*a = append(*a, Address(field))
+	}
+
+	return nil
+
+}
+
+// Retrieve type, mainly used for cobra
+func (a *Addresses) Type() string {
+	return "addresses"
+}
+
+// List of names, e.g. of receivers
+type Names []string
+
+// Return comma-separated string of all names
+func (n *Names) String() string {
+	return strings.Join(*n, ",")
+}
+
+// Setter, mainly used for cobra.
+// Accepts one or more names, separated by commas or spaces
+func (n *Names) Set(v string) error {
+
+	// Config files and env variables may give us something like "[a b]" or "a,b"
+	fields := strings.FieldsFunc(v, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '[' || r == ']'
+	})
+
+	*n = append(*n, fields...)
+
+	return nil
+
+}
+
+// Retrieve type, mainly used for cobra
+func (n *Names) Type() string {
+	return "names"
+}
+
+// Single receiver to create on startup, besides the default one of each type
+type ReceiverInstance struct {
+	Name   string  `json:"name"`   // Unique name of the receiver, used to pick it
+	Type   string  `json:"type"`   // Registered type of the receiver, e.g. "VirtualMotionCapture"
+	Listen Address `json:"listen"` // Address interface to listen on, instead of the one configured for its type
+	Device Address `json:"device"` // Address of phone/device to ask for data, instead of the one configured for its type
+}
+
+// List of receiver instances
+type ReceiverInstances []ReceiverInstance
+
+// Return comma-separated string of all instances, in the same format accepted by Set
+func (r *ReceiverInstances) String() string {
+
+	var instances []string
+	for _, instance := range *r {
+
+		text := instance.Name + "=" + instance.Type
+		if instance.Listen != "" || instance.Device != "" {
+			text += "@" + instance.Listen.String()
+		}
+		if instance.Device != "" {
+			text += "@" + instance.Device.String()
+		}
+
+		instances = append(instances, text)
+
+	}
+
+	return strings.Join(instances, ",")
+
+}
+
+// Setter, mainly used for cobra.
+// Accepts one or more comma-separated instances, each formatted as "name=type", "name=type@listen" or "name=type@listen@device"
+func (r *ReceiverInstances) Set(v string) error {
+
+	for _, field := range strings.Split(v, ",") {
+
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		nameAndRest := strings.SplitN(field, "=", 2)
+		if len(nameAndRest) != 2 || nameAndRest[0] == "" {
+			return fmt.Errorf("receiver \"%s\" must be formatted as name=type", field)
+		}
+
+		parts := strings.Split(nameAndRest[1], "@")
+		instance := ReceiverInstance{
+			Name: nameAndRest[0],
+			Type: parts[0],
+		}
+
+		if len(parts) > 1 {
+			instance.Listen = Address(parts[1])
+		}
+
+		if len(parts) > 2 {
+			instance.Device = Address(parts[2])
+		}
+
+		*r = append(*r, instance)
+
+	}
+
+	return nil
+
+}
+
+// Retrieve type, mainly used for cobra
+func (r *ReceiverInstances) Type() string {
+	return "receivers"
+}
+
 // Config used during the start of the application
 type App struct {
-	VMCListen            Address `json:"vmc_listen"`             // Address interface the VMC server listens on
-	FM3DListen           Address `json:"fm3d_listen"`            // Address interface the Facemotion3D server listens on
-	FM3DDevice           Address `json:"fm3d_device"`            // IP address of phone/device to tell to start sending Facemotion3D data
-	APIListen            Address `json:"api_listen"`             // Address interface the API server listens on
-	ModelUpdateFrequency int     `json:"model_update_frequency"` // Times per second the model transformation data is sent to clients
-	SceneDirPath         string  `json:"scene_home"`             // Path to scene directory
-	SceneConfigPath      string  `json:"scene_file"`             // Path to scene config file
-	AppConfigPath        string  `json:"config_file"`            // Path to app config file
-	VRMFilePath          string  `json:"vrm_file"`               // Path to VRM file
-	Receiver             string  `json:"receiver"`               // Name of receiver to use on startup
+	VMCListen            Address           `json:"vmc_listen"`             // Address interface the VMC server listens on
+	VMCSend              Addresses         `json:"vmc_send"`               // Addresses to send VMC data to, as a VMC performer
+	VMCSendFrequency     int               `json:"vmc_send_frequency"`     // Times per second VMC data is sent to each address
+	VMCCamera            bool              `json:"vmc_camera"`             // If the VMC source controls the camera, instead of camera writer clients
+	FM3DListen           Address           `json:"fm3d_listen"`            // Address interface the Facemotion3D server listens on
+	FM3DDevice           Address           `json:"fm3d_device"`            // IP address of phone/device to tell to start sending Facemotion3D data
+	IFMListen            Address           `json:"ifm_listen"`             // Address interface the iFacialMocap server listens on
+	IFMDevice            Address           `json:"ifm_device"`             // IP address of phone/device to tell to start sending iFacialMocap data
+	VTSListen            Address           `json:"vts_listen"`             // Address interface the VTube Studio server listens on
+	VTSDevice            Address           `json:"vts_device"`             // IP address of phone/device to ask for VTube Studio data
+	OSFListen            Address           `json:"osf_listen"`             // Address interface the OpenSeeFace server listens on
+	MPListen             Address           `json:"mediapipe_listen"`       // Address interface the dedicated MediapipeWeb server listens on, if any
+	ReplayFile           string            `json:"replay_file"`            // Recording to play back, either a name in the recordings directory or a path
+	ReplayLoop           bool              `json:"replay_loop"`            // If playback starts over once the recording ends
+	ReplaySpeed          float64           `json:"replay_speed"`           // How fast the recording is played back, where 1 is real-time
+	BVHFile              string            `json:"bvh_file"`               // Path to BVH motion capture file to play back
+	BVHScale             float64           `json:"bvh_scale"`              // Multiplier converting BVH units into meters
+	BVHLoop              bool              `json:"bvh_loop"`               // If BVH playback starts over once the motion ends
+	IdleBreathRate       float64           `json:"idle_breath_rate"`       // Breaths per minute of the Idle receiver
+	IdleBreathDepth      float64           `json:"idle_breath_depth"`      // Degrees the spine and chest bend when breathing
+	IdleBlinkInterval    float64           `json:"idle_blink_interval"`    // Average seconds between blinks of the Idle receiver
+	IdleSway             float64           `json:"idle_sway"`              // Degrees the head sways around
+	IdleSaccadeInterval  float64           `json:"idle_saccade_interval"`  // Average seconds between eye movements of the Idle receiver
+	IdleArmAngle         float64           `json:"idle_arm_angle"`         // Degrees the arms are lowered from a T-pose
+	LipSyncWAV           string            `json:"lipsync_wav"`            // Path to WAV file for the LipSync receiver to play, instead of listening for audio
+	LipSyncThreshold     float64           `json:"lipsync_threshold"`      // Loudness in decibels below which the mouth stays closed
+	LipSyncSmoothing     float64           `json:"lipsync_smoothing"`      // How much of the previous mouth shape to keep each update, from 0 to 1
+	Failover             Names             `json:"failover"`               // Receivers for the Failover receiver to pick from, most preferred first
+	FailoverTimeout      float64           `json:"failover_timeout"`       // Seconds without data before the Failover receiver moves on to the next receiver
+	FailoverCrossfade    float64           `json:"failover_crossfade"`     // Seconds the Failover receiver takes to blend from one receiver to another
+	APIListen            Address           `json:"api_listen"`             // Address interface the API server listens on
+	ModelUpdateFrequency int               `json:"model_update_frequency"` // Times per second the model transformation data is sent to clients
+	SceneDirPath         string            `json:"scene_home"`             // Path to scene directory
+	SceneConfigPath      string            `json:"scene_file"`             // Path to scene config file
+	AppConfigPath        string            `json:"config_file"`            // Path to app config file
+	VRMFilePath          string            `json:"vrm_file"`               // Path to VRM file
+	RecordingsDirPath    string            `json:"recordings_home"`        // Path to directory of motion recordings
+	Receiver             string            `json:"receiver"`               // Name of receiver to use on startup
+	Receivers            ReceiverInstances `json:"receivers"`              // Extra receivers to create on startup, e.g. a second VMC port
 
 	pool.Pool `json:"-"`
 }
@@ -86,16 +259,125 @@ func NewApp() *App {
 	}
 }
 
+// Which receiver each part of the model comes from, when compositing several receivers at once.
+// Bones and blend shapes not listed, or listed under "*", use that receiver instead.
+type Compositor struct {
+	Default     string            `json:"default"`      // Receiver for anything not listed elsewhere, including the root and trackers
+	Bones       map[string]string `json:"bones"`        // Receiver for each bone, by name
+	BlendShapes map[string]string `json:"blend_shapes"` // Receiver for each blend shape, by name
+}
+
+// Name of every receiver used by the compositor
+func (c Compositor) Receivers() []string {
+
+	used := make(map[string]bool)
+	if c.Default != "" {
+		used[c.Default] = true
+	}
+
+	for _, receiver := range c.Bones {
+		used[receiver] = true
+	}
+
+	for _, receiver := range c.BlendShapes {
+		used[receiver] = true
+	}
+
+	var receivers []string
+	for receiver := range used {
+		receivers = append(receivers, receiver)
+	}
+
+	return receivers
+
+}
+
 // Config used for the looks and appearance of the model viewer.
 // This is what most people will care about.
 type Scene struct {
-	Camera obj.Camera `json:"camera"`
+	Camera     obj.Camera `json:"camera"`     // Read and written through ReadCamera and WriteCamera once running
+	Light      obj.Light  `json:"light"`      // Read and written through ReadLight and WriteLight once running
+	Compositor Compositor `json:"compositor"` // Read and written through ReadCompositor and WriteCompositor once running
 
+	mutex     *sync.RWMutex
 	pool.Pool `json:"-"`
 }
 
 func NewScene() *Scene {
 	return &Scene{
-		Pool: pool.New(),
+		mutex: &sync.RWMutex{},
+		Pool:  pool.New(),
 	}
 }
+
+// Safely marshal the scene, as it may be changed by receivers and clients while running
+func (s *Scene) MarshalJSON() ([]byte, error) {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	// Same fields, without this method
+	type scene Scene
+	return json.Marshal((*scene)(s))
+
+}
+
+// Safely read the camera
+func (s *Scene) ReadCamera() obj.Camera {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.Camera
+
+}
+
+// Safely replace the camera
+func (s *Scene) WriteCamera(camera obj.Camera) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Camera = camera
+
+}
+
+// Safely read the light
+func (s *Scene) ReadLight() obj.Light {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.Light
+
+}
+
+// Safely replace the light
+func (s *Scene) WriteLight(light obj.Light) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Light = light
+
+}
+
+// Safely read the compositor mask
+func (s *Scene) ReadCompositor() Compositor {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.Compositor
+
+}
+
+// Safely replace the compositor mask. The maps of the mask must not be changed afterwards.
+func (s *Scene) WriteCompositor(mask Compositor) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Compositor = mask
+
+}
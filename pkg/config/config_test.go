@@ -0,0 +1,98 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReceiverInstancesSet(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		value     string
+		instances ReceiverInstances
+		wantErr   bool
+	}{
+		{
+			name:  "name and type",
+			value: "vmc2=VirtualMotionCapture",
+			instances: ReceiverInstances{
+				{Name: "vmc2", Type: "VirtualMotionCapture"},
+			},
+		},
+		{
+			name:  "listen and device addresses",
+			value: "phone=iFacialMocap@0.0.0.0:49984@192.168.1.2",
+			instances: ReceiverInstances{
+				{Name: "phone", Type: "iFacialMocap", Listen: "0.0.0.0:49984", Device: "192.168.1.2"},
+			},
+		},
+		{
+			name:  "comma-separated with spaces and empty fields",
+			value: " a=Idle , ,b=OpenSeeFace@127.0.0.1:11574",
+			instances: ReceiverInstances{
+				{Name: "a", Type: "Idle"},
+				{Name: "b", Type: "OpenSeeFace", Listen: "127.0.0.1:11574"},
+			},
+		},
+		{
+			name:    "missing type",
+			value:   "vmc2",
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			value:   "=Idle",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			var instances ReceiverInstances
+			err := instances.Set(test.value)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(instances, test.instances) {
+				t.Fatalf("Set(%q) = %+v, want %+v", test.value, instances, test.instances)
+			}
+
+			// Whatever String returns can be set again, giving the same instances
+			var again ReceiverInstances
+			if err := again.Set(instances.String()); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again, instances) {
+				t.Errorf("Set(%q) = %+v, want %+v", instances.String(), again, instances)
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,147 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+	"github.com/thatpix3l/fntwo/pkg/recorder"
+)
+
+const (
+	bvhScale = 100 // BVH files are usually in centimeters
+)
+
+// Euler angles of a rotation, in degrees, in the order they're written to BVH channels.
+// BVH applies channels in order from the parent down, so the rotation is Z * X * Y.
+func eulerZXY(rotation obj.QuaternionRotation) (float64, float64, float64) {
+
+	m := rotation.Matrix()
+
+	var x, y, z float64
+	if math.Abs(m[2][1]) < 0.9999 {
+		x = math.Asin(m[2][1])
+		y = math.Atan2(-m[2][0], m[2][2])
+		z = math.Atan2(-m[0][1], m[1][1])
+	} else {
+
+		// Looking straight up or down, where Y and Z turn around the same axis
+		x = math.Copysign(math.Pi/2, m[2][1])
+		z = math.Atan2(m[1][0], m[0][0])
+
+	}
+
+	return z * 180 / math.Pi, x * 180 / math.Pi, y * 180 / math.Pi
+
+}
+
+// Write the hierarchy of a bone and all of its children
+func writeBVHJoint(w *bufio.Writer, index int, depth int) {
+
+	bone := skeleton[index]
+	indent := strings.Repeat("\t", depth)
+
+	keyword := "JOINT"
+	channels := "CHANNELS 3 Zrotation Xrotation Yrotation"
+	if bone.parent < 0 {
+		keyword = "ROOT"
+		channels = "CHANNELS 6 Xposition Yposition Zposition Zrotation Xrotation Yrotation"
+	}
+
+	fmt.Fprintf(w, "%s%s %s\n", indent, keyword, bone.name)
+	fmt.Fprintf(w, "%s{\n", indent)
+	fmt.Fprintf(w, "%s\tOFFSET %g %g %g\n", indent, bone.offset.X*bvhScale, bone.offset.Y*bvhScale, bone.offset.Z*bvhScale)
+	fmt.Fprintf(w, "%s\t%s\n", indent, channels)
+
+	hasChildren := false
+	for i, child := range skeleton {
+		if child.parent == index {
+			hasChildren = true
+			writeBVHJoint(w, i, depth+1)
+		}
+	}
+
+	// Every branch has to end somewhere
+	if !hasChildren {
+		fmt.Fprintf(w, "%s\tEnd Site\n", indent)
+		fmt.Fprintf(w, "%s\t{\n", indent)
+		fmt.Fprintf(w, "%s\t\tOFFSET 0 0 0\n", indent)
+		fmt.Fprintf(w, "%s\t}\n", indent)
+	}
+
+	fmt.Fprintf(w, "%s}\n", indent)
+
+}
+
+// Write a recording as a BVH motion capture file, in centimeters
+func BVH(writer io.Writer, recording *recorder.Recording) error {
+
+	frames, frameTime := resample(recording)
+
+	w := bufio.NewWriter(writer)
+
+	fmt.Fprintln(w, "HIERARCHY")
+	writeBVHJoint(w, 0, 0)
+
+	fmt.Fprintln(w, "MOTION")
+	fmt.Fprintf(w, "Frames: %d\n", len(frames))
+	fmt.Fprintf(w, "Frame Time: %g\n", frameTime)
+
+	// Channels are written in the same order as the hierarchy
+	order := bvhOrder(0, nil)
+	for _, frame := range frames {
+
+		var values []string
+		for _, index := range order {
+
+			if skeleton[index].parent < 0 {
+				position := hipsPosition(frame)
+				values = append(values, fmt.Sprintf("%.4f %.4f %.4f", position.X*bvhScale, position.Y*bvhScale, position.Z*bvhScale))
+			}
+
+			z, x, y := eulerZXY(boneRotation(frame, skeleton[index].name))
+			values = append(values, fmt.Sprintf("%.4f %.4f %.4f", z, x, y))
+
+		}
+
+		fmt.Fprintln(w, strings.Join(values, " "))
+
+	}
+
+	return w.Flush()
+
+}
+
+// Indices of a bone and all of its children, in the order they are written to the hierarchy
+func bvhOrder(index int, order []int) []int {
+
+	order = append(order, index)
+	for i, child := range skeleton {
+		if child.parent == index {
+			order = bvhOrder(i, order)
+		}
+	}
+
+	return order
+
+}
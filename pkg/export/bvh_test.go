@@ -0,0 +1,82 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package export
+
+import (
+	"math"
+	"testing"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+// Rotation made of Euler angles in degrees, applied as Z * X * Y like BVH does
+func fromEulerZXY(z float64, x float64, y float64) obj.QuaternionRotation {
+
+	toRadians := math.Pi / 180
+
+	return obj.QuaternionFromAxisAngle(obj.Position{Z: 1}, z*toRadians).
+		Multiply(obj.QuaternionFromAxisAngle(obj.Position{X: 1}, x*toRadians)).
+		Multiply(obj.QuaternionFromAxisAngle(obj.Position{Y: 1}, y*toRadians))
+
+}
+
+func TestEulerZXY(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		z, x, y float64
+		gimbal  bool // Only the rotation as a whole is unique, not each angle
+	}{
+		{name: "no rotation"},
+		{name: "only Z", z: 30},
+		{name: "only X", x: -45},
+		{name: "only Y", y: 120},
+		{name: "every axis", z: 10, x: 20, y: 30},
+		{name: "every axis negative", z: -75, x: -60, y: -150},
+		{name: "looking straight up", z: 20, x: 90, y: 40, gimbal: true},
+		{name: "looking straight down", z: -35, x: -90, y: 10, gimbal: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			rotation := fromEulerZXY(test.z, test.x, test.y)
+			z, x, y := eulerZXY(rotation)
+
+			// Same rotation, including either sign of the quaternion
+			got := fromEulerZXY(z, x, y)
+			dot := got.X*rotation.X + got.Y*rotation.Y + got.Z*rotation.Z + got.W*rotation.W
+			if math.Abs(math.Abs(dot)-1) > 1e-6 {
+				t.Errorf("eulerZXY() = %v, %v, %v, which is a different rotation", z, x, y)
+			}
+
+			if test.gimbal {
+				return
+			}
+
+			for _, angle := range [][2]float64{{z, test.z}, {x, test.x}, {y, test.y}} {
+				if math.Abs(angle[0]-angle[1]) > 1e-6 {
+					t.Errorf("eulerZXY() = %v, %v, %v, want %v, %v, %v", z, x, y, test.z, test.x, test.y)
+					break
+				}
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,191 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package export
+
+import (
+	"io"
+	"math"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+	"github.com/thatpix3l/fntwo/pkg/recorder"
+)
+
+// Animation file format that recordings can be exported to
+type Format struct {
+	Extension   string                                     // File extension, including the leading dot
+	ContentType string                                     // MIME type, for serving over HTTP
+	Write       func(io.Writer, *recorder.Recording) error // Write a recording in this format
+}
+
+// Single bone of the skeleton that animations are exported with
+type skeletonBone struct {
+	name   string       // Name of bone, based off of Unity's HumanBodyBones
+	parent int          // Index of parent bone, or -1 for the root
+	offset obj.Position // Offset from the parent bone in a T-pose, in meters
+}
+
+var (
+	// Every supported format, by name
+	Formats = map[string]Format{
+		"bvh": {
+			Extension:   ".bvh",
+			ContentType: "text/plain",
+			Write:       BVH,
+		},
+		"vrma": {
+			Extension:   ".vrma",
+			ContentType: "model/gltf-binary",
+			Write:       VRMA,
+		},
+	}
+
+	// Humanoid skeleton of average proportions, in right-handed coordinates where the body faces positive Z.
+	// Only rotations are recorded, so the exact proportions don't matter much.
+	skeleton = newSkeleton()
+)
+
+// Build the skeleton, mirroring the left side of the body onto the right
+func newSkeleton() []skeletonBone {
+
+	var bones []skeletonBone
+	add := func(name string, parent string, offset obj.Position) {
+
+		parentIndex := -1
+		for i, bone := range bones {
+			if bone.name == parent {
+				parentIndex = i
+			}
+		}
+
+		bones = append(bones, skeletonBone{name: name, parent: parentIndex, offset: offset})
+
+	}
+
+	add("Hips", "", obj.Position{Y: 0.9})
+	add("Spine", "Hips", obj.Position{Y: 0.1})
+	add("Chest", "Spine", obj.Position{Y: 0.12})
+	add("UpperChest", "Chest", obj.Position{Y: 0.12})
+	add("Neck", "UpperChest", obj.Position{Y: 0.1})
+	add("Head", "Neck", obj.Position{Y: 0.08})
+
+	for _, side := range []string{"Left", "Right"} {
+
+		// The left side of the body is towards positive X
+		x := 1.0
+		if side == "Right" {
+			x = -1
+		}
+
+		add(side+"Eye", "Head", obj.Position{X: 0.03 * x, Y: 0.06, Z: 0.07})
+
+		add(side+"UpperLeg", "Hips", obj.Position{X: 0.08 * x, Y: -0.05})
+		add(side+"LowerLeg", side+"UpperLeg", obj.Position{Y: -0.4})
+		add(side+"Foot", side+"LowerLeg", obj.Position{Y: -0.4})
+		add(side+"Toes", side+"Foot", obj.Position{Y: -0.05, Z: 0.12})
+
+		add(side+"Shoulder", "UpperChest", obj.Position{X: 0.03 * x, Y: 0.07})
+		add(side+"UpperArm", side+"Shoulder", obj.Position{X: 0.1 * x})
+		add(side+"LowerArm", side+"UpperArm", obj.Position{X: 0.25 * x})
+		add(side+"Hand", side+"LowerArm", obj.Position{X: 0.23 * x})
+
+		// Base of each finger on the palm, and how long each of its bones are
+		fingers := []struct {
+			name   string
+			base   obj.Position
+			length float64
+		}{
+			{"Thumb", obj.Position{X: 0.02 * x, Y: -0.01, Z: 0.025}, 0.03},
+			{"Index", obj.Position{X: 0.08 * x, Z: 0.025}, 0.03},
+			{"Middle", obj.Position{X: 0.08 * x, Z: 0.005}, 0.033},
+			{"Ring", obj.Position{X: 0.075 * x, Z: -0.015}, 0.03},
+			{"Little", obj.Position{X: 0.07 * x, Z: -0.035}, 0.025},
+		}
+		for _, finger := range fingers {
+			add(side+finger.name+"Proximal", side+"Hand", finger.base)
+			add(side+finger.name+"Intermediate", side+finger.name+"Proximal", obj.Position{X: finger.length * x})
+			add(side+finger.name+"Distal", side+finger.name+"Intermediate", obj.Position{X: finger.length * 0.8 * x})
+		}
+
+	}
+
+	return bones
+
+}
+
+// Convert a bone rotation as stored in obj.VRM back into right-handed coordinates, where the body faces positive Z.
+// This undoes both the conversion from Unity's coordinates and the one done by obj.VRM.WriteBone.
+func convertRotation(rotation obj.QuaternionRotation) obj.QuaternionRotation {
+	return obj.QuaternionRotation{
+		X: rotation.X,
+		Y: -rotation.Y,
+		Z: rotation.Z,
+		W: rotation.W,
+	}.Normalize()
+}
+
+// Convert a bone position from Unity's left-handed coordinates into right-handed coordinates
+func convertPosition(position obj.Position) obj.Position {
+	return obj.Position{
+		X: position.X,
+		Y: position.Y,
+		Z: -position.Z,
+	}
+}
+
+// Rotation of a skeleton bone in a frame, which is no rotation if the bone wasn't tracked
+func boneRotation(frame obj.Frame, name string) obj.QuaternionRotation {
+
+	bone, ok := frame.Bones[name]
+	if !ok || bone.Rotation.Quaternion == (obj.QuaternionRotation{}) {
+		return obj.QuaternionRotation{W: 1}
+	}
+
+	return convertRotation(bone.Rotation.Quaternion)
+
+}
+
+// Position of the hips in a frame, which is where they are in a T-pose if they weren't moved
+func hipsPosition(frame obj.Frame) obj.Position {
+
+	hips, ok := frame.Bones["Hips"]
+	if !ok || hips.Position == (obj.Position{}) {
+		return skeleton[0].offset
+	}
+
+	return convertPosition(hips.Position)
+
+}
+
+// Resample a recording at a steady rate, returning every frame and the seconds between them
+func resample(recording *recorder.Recording) ([]obj.Frame, float64) {
+
+	frequency := recording.Frequency
+	if frequency <= 0 {
+		frequency = 60
+	}
+	frameTime := 1 / float64(frequency)
+
+	count := int(math.Floor(recording.Duration()/frameTime)) + 1
+	frames := make([]obj.Frame, count)
+	for i := range frames {
+		frames[i] = recording.At(float64(i) * frameTime)
+	}
+
+	return frames, frameTime
+
+}
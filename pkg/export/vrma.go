@@ -0,0 +1,371 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+	"github.com/thatpix3l/fntwo/pkg/recorder"
+)
+
+const (
+	glbMagic     = 0x46546C67 // "glTF"
+	glbVersion   = 2
+	glbChunkJSON = 0x4E4F534A // "JSON"
+	glbChunkBIN  = 0x004E4942 // "BIN"
+
+	componentFloat = 5126 // glTF component type of 32-bit floats
+)
+
+var (
+	// VRM 0.x preset blend shapes, mapped to VRM 1.0 preset expressions.
+	// Anything else is exported as a custom expression.
+	presetExpressions = map[string]string{
+		obj.BlendShapeNeutral:   "neutral",
+		obj.BlendShapeA:         "aa",
+		obj.BlendShapeI:         "ih",
+		obj.BlendShapeU:         "ou",
+		obj.BlendShapeE:         "ee",
+		obj.BlendShapeO:         "oh",
+		obj.BlendShapeBlink:     "blink",
+		obj.BlendShapeBlinkL:    "blinkLeft",
+		obj.BlendShapeBlinkR:    "blinkRight",
+		obj.BlendShapeJoy:       "happy",
+		obj.BlendShapeAngry:     "angry",
+		obj.BlendShapeSorrow:    "sad",
+		obj.BlendShapeFun:       "relaxed",
+		obj.BlendShapeLookUp:    "lookUp",
+		obj.BlendShapeLookDown:  "lookDown",
+		obj.BlendShapeLookLeft:  "lookLeft",
+		obj.BlendShapeLookRight: "lookRight",
+	}
+)
+
+type gltfNode struct {
+	Name        string     `json:"name"`
+	Translation [3]float64 `json:"translation"`
+	Children    []int      `json:"children,omitempty"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float64 `json:"min,omitempty"`
+	Max           []float64 `json:"max,omitempty"`
+}
+
+type gltfChannel struct {
+	Sampler int `json:"sampler"`
+	Target  struct {
+		Node int    `json:"node"`
+		Path string `json:"path"`
+	} `json:"target"`
+}
+
+type gltfSampler struct {
+	Input         int    `json:"input"`
+	Output        int    `json:"output"`
+	Interpolation string `json:"interpolation"`
+}
+
+type gltfAnimation struct {
+	Channels []gltfChannel `json:"channels"`
+	Samplers []gltfSampler `json:"samplers"`
+}
+
+type vrmaNode struct {
+	Node int `json:"node"`
+}
+
+type vrmaExtension struct {
+	SpecVersion string `json:"specVersion"`
+	Humanoid    struct {
+		HumanBones map[string]vrmaNode `json:"humanBones"`
+	} `json:"humanoid"`
+	Expressions struct {
+		Preset map[string]vrmaNode `json:"preset,omitempty"`
+		Custom map[string]vrmaNode `json:"custom,omitempty"`
+	} `json:"expressions"`
+}
+
+type gltf struct {
+	Asset struct {
+		Version   string `json:"version"`
+		Generator string `json:"generator"`
+	} `json:"asset"`
+	ExtensionsUsed []string `json:"extensionsUsed"`
+	Extensions     struct {
+		VRMAnimation vrmaExtension `json:"VRMC_vrm_animation"`
+	} `json:"extensions"`
+	Scene  int `json:"scene"`
+	Scenes []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes"`
+	Buffers     []map[string]int `json:"buffers"`
+	BufferViews []gltfBufferView `json:"bufferViews"`
+	Accessors   []gltfAccessor   `json:"accessors"`
+	Animations  []gltfAnimation  `json:"animations"`
+}
+
+// Builds up the binary buffer and accessors of a glTF file
+type gltfBuilder struct {
+	doc *gltf
+	bin bytes.Buffer
+}
+
+// Append float values to the buffer, returning the index of a new accessor for them
+func (b *gltfBuilder) accessor(values []float32, kind string, components int, bounds bool) int {
+
+	view := gltfBufferView{
+		ByteOffset: b.bin.Len(),
+		ByteLength: len(values) * 4,
+	}
+	binary.Write(&b.bin, binary.LittleEndian, values)
+	b.doc.BufferViews = append(b.doc.BufferViews, view)
+
+	accessor := gltfAccessor{
+		BufferView:    len(b.doc.BufferViews) - 1,
+		ComponentType: componentFloat,
+		Count:         len(values) / components,
+		Type:          kind,
+	}
+
+	// Animation inputs are required to have their range
+	if bounds {
+		accessor.Min = []float64{math.Inf(1)}
+		accessor.Max = []float64{math.Inf(-1)}
+		for _, value := range values {
+			accessor.Min[0] = math.Min(accessor.Min[0], float64(value))
+			accessor.Max[0] = math.Max(accessor.Max[0], float64(value))
+		}
+	}
+
+	b.doc.Accessors = append(b.doc.Accessors, accessor)
+	return len(b.doc.Accessors) - 1
+
+}
+
+// Animate a node's property using the given accessor for its values
+func (b *gltfBuilder) channel(animation *gltfAnimation, input int, output int, node int, path string) {
+
+	animation.Samplers = append(animation.Samplers, gltfSampler{
+		Input:         input,
+		Output:        output,
+		Interpolation: "LINEAR",
+	})
+
+	var channel gltfChannel
+	channel.Sampler = len(animation.Samplers) - 1
+	channel.Target.Node = node
+	channel.Target.Path = path
+	animation.Channels = append(animation.Channels, channel)
+
+}
+
+// Name of a VRM 1.0 human bone, from the name of one of Unity's HumanBodyBones.
+// Thumbs have one more bone in VRM 1.0 at the base, so their names shift by one.
+func humanBoneName(name string) string {
+
+	name = strings.NewReplacer(
+		"ThumbProximal", "ThumbMetacarpal",
+		"ThumbIntermediate", "ThumbProximal",
+	).Replace(name)
+
+	return strings.ToLower(name[:1]) + name[1:]
+
+}
+
+// Write a recording as a VRM Animation, which is a binary glTF file with the VRMC_vrm_animation extension.
+// Expressions are animated through the X translation of a node per expression.
+func VRMA(writer io.Writer, recording *recorder.Recording) error {
+
+	frames, frameTime := resample(recording)
+
+	doc := &gltf{}
+	doc.Asset.Version = "2.0"
+	doc.Asset.Generator = "fntwo"
+	doc.ExtensionsUsed = []string{"VRMC_vrm_animation"}
+	doc.Extensions.VRMAnimation.SpecVersion = "1.0"
+	doc.Extensions.VRMAnimation.Humanoid.HumanBones = make(map[string]vrmaNode)
+	doc.Scenes = make([]struct {
+		Nodes []int `json:"nodes"`
+	}, 1)
+
+	builder := &gltfBuilder{doc: doc}
+
+	// Find what was actually recorded, so nothing else is animated
+	trackedBones := make(map[string]bool)
+	trackedBlendShapes := make(map[string]bool)
+	hipsMoved := false
+	for _, frame := range frames {
+
+		for name, bone := range frame.Bones {
+			trackedBones[name] = true
+			if name == "Hips" && bone.Position != (obj.Position{}) {
+				hipsMoved = true
+			}
+		}
+
+		for name := range frame.BlendShapes {
+			trackedBlendShapes[name] = true
+		}
+
+	}
+
+	// Skeleton nodes, in the same order as the skeleton itself
+	for i, bone := range skeleton {
+
+		doc.Nodes = append(doc.Nodes, gltfNode{
+			Name:        bone.name,
+			Translation: [3]float64{bone.offset.X, bone.offset.Y, bone.offset.Z},
+		})
+
+		if bone.parent >= 0 {
+			doc.Nodes[bone.parent].Children = append(doc.Nodes[bone.parent].Children, i)
+		}
+
+		doc.Extensions.VRMAnimation.Humanoid.HumanBones[humanBoneName(bone.name)] = vrmaNode{Node: i}
+
+	}
+	doc.Scenes[0].Nodes = append(doc.Scenes[0].Nodes, 0)
+
+	// Time of every frame, shared by all animation channels
+	times := make([]float32, len(frames))
+	for i := range frames {
+		times[i] = float32(float64(i) * frameTime)
+	}
+	input := builder.accessor(times, "SCALAR", 1, true)
+
+	animation := gltfAnimation{}
+
+	for i, bone := range skeleton {
+
+		if !trackedBones[bone.name] {
+			continue
+		}
+
+		rotations := make([]float32, 0, len(frames)*4)
+		for _, frame := range frames {
+			rotation := boneRotation(frame, bone.name)
+			rotations = append(rotations, float32(rotation.X), float32(rotation.Y), float32(rotation.Z), float32(rotation.W))
+		}
+		builder.channel(&animation, input, builder.accessor(rotations, "VEC4", 4, false), i, "rotation")
+
+	}
+
+	if hipsMoved {
+
+		translations := make([]float32, 0, len(frames)*3)
+		for _, frame := range frames {
+			position := hipsPosition(frame)
+			translations = append(translations, float32(position.X), float32(position.Y), float32(position.Z))
+		}
+		builder.channel(&animation, input, builder.accessor(translations, "VEC3", 3, false), 0, "translation")
+
+	}
+
+	// Sort expressions so the same recording always exports the same file
+	var blendShapeNames []string
+	for name := range trackedBlendShapes {
+		blendShapeNames = append(blendShapeNames, name)
+	}
+	sort.Strings(blendShapeNames)
+
+	for _, name := range blendShapeNames {
+
+		node := len(doc.Nodes)
+		doc.Nodes = append(doc.Nodes, gltfNode{Name: "Expression_" + name})
+		doc.Scenes[0].Nodes = append(doc.Scenes[0].Nodes, node)
+
+		if preset, ok := presetExpressions[name]; ok {
+			if doc.Extensions.VRMAnimation.Expressions.Preset == nil {
+				doc.Extensions.VRMAnimation.Expressions.Preset = make(map[string]vrmaNode)
+			}
+			doc.Extensions.VRMAnimation.Expressions.Preset[preset] = vrmaNode{Node: node}
+		} else {
+			if doc.Extensions.VRMAnimation.Expressions.Custom == nil {
+				doc.Extensions.VRMAnimation.Expressions.Custom = make(map[string]vrmaNode)
+			}
+			doc.Extensions.VRMAnimation.Expressions.Custom[name] = vrmaNode{Node: node}
+		}
+
+		weights := make([]float32, 0, len(frames)*3)
+		for _, frame := range frames {
+			weights = append(weights, float32(frame.BlendShapes[name]), 0, 0)
+		}
+		builder.channel(&animation, input, builder.accessor(weights, "VEC3", 3, false), node, "translation")
+
+	}
+
+	if len(animation.Channels) > 0 {
+		doc.Animations = append(doc.Animations, animation)
+	}
+
+	doc.Buffers = []map[string]int{{"byteLength": builder.bin.Len()}}
+
+	jsonBytes, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return writeGLB(writer, jsonBytes, builder.bin.Bytes())
+
+}
+
+// Write a binary glTF container with a JSON chunk and a binary chunk, each padded to 4 bytes
+func writeGLB(w io.Writer, jsonBytes []byte, bin []byte) error {
+
+	for len(jsonBytes)%4 != 0 {
+		jsonBytes = append(jsonBytes, ' ')
+	}
+
+	for len(bin)%4 != 0 {
+		bin = append(bin, 0)
+	}
+
+	var glb bytes.Buffer
+
+	header := []uint32{glbMagic, glbVersion, uint32(12 + 8 + len(jsonBytes) + 8 + len(bin))}
+	binary.Write(&glb, binary.LittleEndian, header)
+
+	binary.Write(&glb, binary.LittleEndian, []uint32{uint32(len(jsonBytes)), glbChunkJSON})
+	glb.Write(jsonBytes)
+
+	binary.Write(&glb, binary.LittleEndian, []uint32{uint32(len(bin)), glbChunkBIN})
+	glb.Write(bin)
+
+	_, err := glb.WriteTo(w)
+	return err
+
+}
@@ -34,3 +34,13 @@ func WebSocketUpgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn,
 
 	return ws, err
 }
+
+// Helper func to allow all origin, headers, and methods for HTTP requests.
+func AllowHTTPAllPerms(wPtr *http.ResponseWriter) {
+
+	// Set CORS policy
+	(*wPtr).Header().Set("Access-Control-Allow-Origin", "*")
+	(*wPtr).Header().Set("Access-Control-Allow-Methods", "*")
+	(*wPtr).Header().Set("Access-Control-Allow-Headers", "*")
+
+}
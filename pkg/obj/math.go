@@ -0,0 +1,378 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package obj
+
+import "math"
+
+// Limit value to between 0 and 1
+func Clamp(value float64) float64 {
+
+	if value > 1 {
+		return 1
+	}
+
+	if value < 0 {
+		return 0
+	}
+
+	return value
+
+}
+
+// Sum of two positions
+func (p Position) Add(o Position) Position {
+	return Position{
+		X: p.X + o.X,
+		Y: p.Y + o.Y,
+		Z: p.Z + o.Z,
+	}
+}
+
+// Difference of two positions
+func (p Position) Sub(o Position) Position {
+	return Position{
+		X: p.X - o.X,
+		Y: p.Y - o.Y,
+		Z: p.Z - o.Z,
+	}
+}
+
+// Position with each coordinate multiplied by a scalar
+func (p Position) Scale(s float64) Position {
+	return Position{
+		X: p.X * s,
+		Y: p.Y * s,
+		Z: p.Z * s,
+	}
+}
+
+// Length of position, treated as a vector
+func (p Position) Length() float64 {
+	return math.Sqrt(p.X*p.X + p.Y*p.Y + p.Z*p.Z)
+}
+
+// Hamilton product of two quaternions, where the result applies o first, then q
+func (q QuaternionRotation) Multiply(o QuaternionRotation) QuaternionRotation {
+	return QuaternionRotation{
+		X: q.W*o.X + q.X*o.W + q.Y*o.Z - q.Z*o.Y,
+		Y: q.W*o.Y - q.X*o.Z + q.Y*o.W + q.Z*o.X,
+		Z: q.W*o.Z + q.X*o.Y - q.Y*o.X + q.Z*o.W,
+		W: q.W*o.W - q.X*o.X - q.Y*o.Y - q.Z*o.Z,
+	}
+}
+
+// Conjugate of quaternion, which for unit quaternions is the inverse rotation
+func (q QuaternionRotation) Conjugate() QuaternionRotation {
+	return QuaternionRotation{
+		X: -q.X,
+		Y: -q.Y,
+		Z: -q.Z,
+		W: q.W,
+	}
+}
+
+// Convert a rotation from right-handed coordinates to Unity's left-handed coordinates, which receivers provide bones in
+func (q QuaternionRotation) Unity() QuaternionRotation {
+	return QuaternionRotation{
+		X: -q.X,
+		Y: -q.Y,
+		Z: q.Z,
+		W: q.W,
+	}
+}
+
+// Rotate a position, treated as a vector, by the quaternion
+func (q QuaternionRotation) Rotate(p Position) Position {
+
+	rotated := q.Multiply(QuaternionRotation{X: p.X, Y: p.Y, Z: p.Z}).Multiply(q.Conjugate())
+
+	return Position{
+		X: rotated.X,
+		Y: rotated.Y,
+		Z: rotated.Z,
+	}
+
+}
+
+// Dot product of two positions, treated as vectors
+func (p Position) Dot(o Position) float64 {
+	return p.X*o.X + p.Y*o.Y + p.Z*o.Z
+}
+
+// Cross product of two positions, treated as vectors
+func (p Position) Cross(o Position) Position {
+	return Position{
+		X: p.Y*o.Z - p.Z*o.Y,
+		Y: p.Z*o.X - p.X*o.Z,
+		Z: p.X*o.Y - p.Y*o.X,
+	}
+}
+
+// Position scaled to a length of 1, treated as a vector
+func (p Position) Normalize() Position {
+
+	length := p.Length()
+	if length == 0 {
+		return p
+	}
+
+	return p.Scale(1 / length)
+
+}
+
+// Quaternion scaled to a length of 1
+func (q QuaternionRotation) Normalize() QuaternionRotation {
+
+	length := math.Sqrt(q.X*q.X + q.Y*q.Y + q.Z*q.Z + q.W*q.W)
+	if length == 0 {
+		return QuaternionRotation{W: 1}
+	}
+
+	return QuaternionRotation{
+		X: q.X / length,
+		Y: q.Y / length,
+		Z: q.Z / length,
+		W: q.W / length,
+	}
+
+}
+
+// Spherical linear interpolation from q to o, where t is from 0 to 1
+func (q QuaternionRotation) Slerp(o QuaternionRotation, t float64) QuaternionRotation {
+
+	// Take the shortest path
+	cosHalfTheta := q.X*o.X + q.Y*o.Y + q.Z*o.Z + q.W*o.W
+	if cosHalfTheta < 0 {
+		o = QuaternionRotation{X: -o.X, Y: -o.Y, Z: -o.Z, W: -o.W}
+		cosHalfTheta = -cosHalfTheta
+	}
+
+	// Close enough to linearly interpolate
+	if cosHalfTheta > 0.9995 {
+		return QuaternionRotation{
+			X: q.X + (o.X-q.X)*t,
+			Y: q.Y + (o.Y-q.Y)*t,
+			Z: q.Z + (o.Z-q.Z)*t,
+			W: q.W + (o.W-q.W)*t,
+		}.Normalize()
+	}
+
+	halfTheta := math.Acos(cosHalfTheta)
+	sinHalfTheta := math.Sin(halfTheta)
+	ratioQ := math.Sin((1-t)*halfTheta) / sinHalfTheta
+	ratioO := math.Sin(t*halfTheta) / sinHalfTheta
+
+	return QuaternionRotation{
+		X: q.X*ratioQ + o.X*ratioO,
+		Y: q.Y*ratioQ + o.Y*ratioO,
+		Z: q.Z*ratioQ + o.Z*ratioO,
+		W: q.W*ratioQ + o.W*ratioO,
+	}
+
+}
+
+// Create quaternion from a rotation matrix, where each column is a rotated axis.
+// Index is as follows: m[row][column]
+func QuaternionFromMatrix(m [3][3]float64) QuaternionRotation {
+
+	var q QuaternionRotation
+
+	trace := m[0][0] + m[1][1] + m[2][2]
+	switch {
+	case trace > 0:
+		s := 0.5 / math.Sqrt(trace+1)
+		q = QuaternionRotation{
+			X: (m[2][1] - m[1][2]) * s,
+			Y: (m[0][2] - m[2][0]) * s,
+			Z: (m[1][0] - m[0][1]) * s,
+			W: 0.25 / s,
+		}
+	case m[0][0] > m[1][1] && m[0][0] > m[2][2]:
+		s := 2 * math.Sqrt(1+m[0][0]-m[1][1]-m[2][2])
+		q = QuaternionRotation{
+			X: 0.25 * s,
+			Y: (m[0][1] + m[1][0]) / s,
+			Z: (m[0][2] + m[2][0]) / s,
+			W: (m[2][1] - m[1][2]) / s,
+		}
+	case m[1][1] > m[2][2]:
+		s := 2 * math.Sqrt(1+m[1][1]-m[0][0]-m[2][2])
+		q = QuaternionRotation{
+			X: (m[0][1] + m[1][0]) / s,
+			Y: 0.25 * s,
+			Z: (m[1][2] + m[2][1]) / s,
+			W: (m[0][2] - m[2][0]) / s,
+		}
+	default:
+		s := 2 * math.Sqrt(1+m[2][2]-m[0][0]-m[1][1])
+		q = QuaternionRotation{
+			X: (m[0][2] + m[2][0]) / s,
+			Y: (m[1][2] + m[2][1]) / s,
+			Z: 0.25 * s,
+			W: (m[1][0] - m[0][1]) / s,
+		}
+	}
+
+	return q.Normalize()
+
+}
+
+// Create quaternion from three perpendicular unit vectors, which are the rotated X, Y and Z axes
+func QuaternionFromBasis(x Position, y Position, z Position) QuaternionRotation {
+	return QuaternionFromMatrix([3][3]float64{
+		{x.X, y.X, z.X},
+		{x.Y, y.Y, z.Y},
+		{x.Z, y.Z, z.Z},
+	})
+}
+
+// Create quaternion with the shortest rotation from one direction to another
+func QuaternionFromTo(from Position, to Position) QuaternionRotation {
+
+	from = from.Normalize()
+	to = to.Normalize()
+
+	dot := from.Dot(to)
+
+	// Directions are opposite of each other, so rotate halfway around any perpendicular axis
+	if dot < -0.999999 {
+		axis := Position{X: 1}.Cross(from)
+		if axis.Length() < 0.000001 {
+			axis = Position{Y: 1}.Cross(from)
+		}
+		axis = axis.Normalize()
+		return QuaternionRotation{X: axis.X, Y: axis.Y, Z: axis.Z, W: 0}
+	}
+
+	axis := from.Cross(to)
+	return QuaternionRotation{
+		X: axis.X,
+		Y: axis.Y,
+		Z: axis.Z,
+		W: 1 + dot,
+	}.Normalize()
+
+}
+
+// Linear interpolation from p to o, where t is from 0 to 1
+func (p Position) Lerp(o Position, t float64) Position {
+	return p.Add(o.Sub(p).Scale(t))
+}
+
+// Interpolation from f to o, where t is from 0 to 1.
+// Anything only found in one of the frames is kept as-is.
+func (f Frame) Lerp(o Frame, t float64) Frame {
+
+	frame := Frame{
+		Root: Root{
+			Position: f.Root.Position.Lerp(o.Root.Position, t),
+			Rotation: Rotation{
+				Quaternion: f.Root.Rotation.Quaternion.Slerp(o.Root.Rotation.Quaternion, t),
+			},
+			Scale:  f.Root.Scale.Lerp(o.Root.Scale, t),
+			Offset: f.Root.Offset.Lerp(o.Root.Offset, t),
+		},
+		Bones:       make(Bones),
+		BlendShapes: make(BlendShapes),
+		Trackers:    make(Trackers),
+	}
+
+	for key, bone := range f.Bones {
+		frame.Bones[key] = bone
+	}
+	for key, bone := range o.Bones {
+
+		from, ok := f.Bones[key]
+		if !ok {
+			frame.Bones[key] = bone
+			continue
+		}
+
+		frame.Bones[key] = Bone{
+			Position: from.Position.Lerp(bone.Position, t),
+			Rotation: Rotation{
+				Quaternion: from.Rotation.Quaternion.Slerp(bone.Rotation.Quaternion, t),
+			},
+		}
+
+	}
+
+	for key, value := range f.BlendShapes {
+		frame.BlendShapes[key] = value
+	}
+	for key, value := range o.BlendShapes {
+
+		from, ok := f.BlendShapes[key]
+		if !ok {
+			frame.BlendShapes[key] = value
+			continue
+		}
+
+		frame.BlendShapes[key] = from + (value-from)*BlendShape(t)
+
+	}
+
+	for key, tracker := range f.Trackers {
+		frame.Trackers[key] = tracker
+	}
+	for key, tracker := range o.Trackers {
+
+		from, ok := f.Trackers[key]
+		if !ok {
+			frame.Trackers[key] = tracker
+			continue
+		}
+
+		frame.Trackers[key] = Tracker{
+			Kind:     tracker.Kind,
+			Position: from.Position.Lerp(tracker.Position, t),
+			Rotation: Rotation{
+				Quaternion: from.Rotation.Quaternion.Slerp(tracker.Rotation.Quaternion, t),
+			},
+		}
+
+	}
+
+	return frame
+
+}
+
+// Create quaternion that rotates around an axis by an angle, in radians
+func QuaternionFromAxisAngle(axis Position, angle float64) QuaternionRotation {
+
+	axis = axis.Normalize()
+	sin := math.Sin(angle / 2)
+
+	return QuaternionRotation{
+		X: axis.X * sin,
+		Y: axis.Y * sin,
+		Z: axis.Z * sin,
+		W: math.Cos(angle / 2),
+	}
+
+}
+
+// Rotation matrix of a unit quaternion, where each column is a rotated axis.
+// Index is as follows: m[row][column]
+func (q QuaternionRotation) Matrix() [3][3]float64 {
+	return [3][3]float64{
+		{1 - 2*(q.Y*q.Y+q.Z*q.Z), 2 * (q.X*q.Y - q.Z*q.W), 2 * (q.X*q.Z + q.Y*q.W)},
+		{2 * (q.X*q.Y + q.Z*q.W), 1 - 2*(q.X*q.X+q.Z*q.Z), 2 * (q.Y*q.Z - q.X*q.W)},
+		{2 * (q.X*q.Z - q.Y*q.W), 2 * (q.Y*q.Z + q.X*q.W), 1 - 2*(q.X*q.X+q.Y*q.Y)},
+	}
+}
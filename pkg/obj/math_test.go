@@ -0,0 +1,125 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package obj
+
+import (
+	"math"
+	"testing"
+)
+
+// If two rotations are the same, including either sign of the same rotation
+func sameRotation(a QuaternionRotation, b QuaternionRotation) bool {
+	dot := a.X*b.X + a.Y*b.Y + a.Z*b.Z + a.W*b.W
+	return math.Abs(math.Abs(dot)-1) < 1e-9
+}
+
+func TestFrameLerp(t *testing.T) {
+
+	identity := QuaternionRotation{W: 1}
+	quarterTurn := QuaternionFromAxisAngle(Position{Y: 1}, math.Pi/2)
+	eighthTurn := QuaternionFromAxisAngle(Position{Y: 1}, math.Pi/4)
+
+	from := Frame{
+		Root: Root{
+			Rotation: Rotation{Quaternion: identity},
+			Scale:    Position{X: 1, Y: 1, Z: 1},
+		},
+		Bones: Bones{
+			"Head":  {Rotation: Rotation{Quaternion: identity}},
+			"Spine": {Rotation: Rotation{Quaternion: quarterTurn}},
+		},
+		BlendShapes: BlendShapes{
+			"A":     0,
+			"Blink": 0.5,
+		},
+		Trackers: make(Trackers),
+	}
+
+	to := Frame{
+		Root: Root{
+			Position: Position{X: 2},
+			Rotation: Rotation{Quaternion: quarterTurn},
+			Scale:    Position{X: 1, Y: 1, Z: 1},
+		},
+		Bones: Bones{
+			"Head": {
+				Position: Position{Y: 1},
+				Rotation: Rotation{Quaternion: quarterTurn},
+			},
+			"Neck": {Rotation: Rotation{Quaternion: quarterTurn}},
+		},
+		BlendShapes: BlendShapes{
+			"A":   1,
+			"Joy": 0.25,
+		},
+		Trackers: make(Trackers),
+	}
+
+	tests := []struct {
+		name     string
+		t        float64
+		root     Position
+		rotation QuaternionRotation
+		head     QuaternionRotation
+		headY    float64
+		a        BlendShape
+	}{
+		{name: "start", t: 0, root: Position{}, rotation: identity, head: identity, headY: 0, a: 0},
+		{name: "halfway", t: 0.5, root: Position{X: 1}, rotation: eighthTurn, head: eighthTurn, headY: 0.5, a: 0.5},
+		{name: "end", t: 1, root: Position{X: 2}, rotation: quarterTurn, head: quarterTurn, headY: 1, a: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			frame := from.Lerp(to, test.t)
+
+			if frame.Root.Position.Sub(test.root).Length() > 1e-9 {
+				t.Errorf("root position = %+v, want %+v", frame.Root.Position, test.root)
+			}
+			if !sameRotation(frame.Root.Rotation.Quaternion, test.rotation) {
+				t.Errorf("root rotation = %+v, want %+v", frame.Root.Rotation.Quaternion, test.rotation)
+			}
+
+			head := frame.Bones["Head"]
+			if !sameRotation(head.Rotation.Quaternion, test.head) {
+				t.Errorf("head rotation = %+v, want %+v", head.Rotation.Quaternion, test.head)
+			}
+			if math.Abs(head.Position.Y-test.headY) > 1e-9 {
+				t.Errorf("head position Y = %v, want %v", head.Position.Y, test.headY)
+			}
+
+			if math.Abs(float64(frame.BlendShapes["A"]-test.a)) > 1e-9 {
+				t.Errorf("blend shape A = %v, want %v", frame.BlendShapes["A"], test.a)
+			}
+
+			// Anything only found in one of the frames is kept as-is
+			if !sameRotation(frame.Bones["Spine"].Rotation.Quaternion, quarterTurn) {
+				t.Errorf("spine rotation = %+v, want it unchanged", frame.Bones["Spine"].Rotation.Quaternion)
+			}
+			if !sameRotation(frame.Bones["Neck"].Rotation.Quaternion, quarterTurn) {
+				t.Errorf("neck rotation = %+v, want it unchanged", frame.Bones["Neck"].Rotation.Quaternion)
+			}
+			if frame.BlendShapes["Blink"] != 0.5 || frame.BlendShapes["Joy"] != 0.25 {
+				t.Errorf("blend shapes = %v, want Blink and Joy unchanged", frame.BlendShapes)
+			}
+
+		})
+	}
+
+}
@@ -19,6 +19,7 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package obj
 
 import (
+	"strings"
 	"sync"
 )
 
@@ -47,25 +48,129 @@ type Bone struct {
 	Rotation Rotation `json:"rotation"`
 }
 
+// Kinds of tracked devices
+const (
+	TrackerHMD        = "hmd"        // Head mounted display
+	TrackerController = "controller" // Handheld controller
+	TrackerGeneric    = "tracker"    // Generic tracker, e.g. strapped to a body part or prop
+)
+
+// Properties of a single tracked device, like a VR headset, controller or tracker
+type Tracker struct {
+	Kind     string   `json:"kind"` // Kind of device, e.g. TrackerHMD
+	Position Position `json:"position"`
+	Rotation Rotation `json:"rotation"`
+}
+
+// Transformational properties of the VRM model's root
+type Root struct {
+	Position Position `json:"position"`
+	Rotation Rotation `json:"rotation"`
+	Scale    Position `json:"scale"`  // Scale of the whole model
+	Offset   Position `json:"offset"` // Offset of the model from its root, used with scale
+}
+
 // Transformational properties of the ThreeJS camera
 type Camera struct {
 	GazeTowards Position `json:"gaze_towards"`
 	GazeFrom    Position `json:"gaze_from"`
+	FOV         float64  `json:"fov"` // Vertical field of view, in degrees
+}
+
+// Color with red, green, blue and alpha channels, each from 0 to 1
+type Color struct {
+	R float64 `json:"r"`
+	G float64 `json:"g"`
+	B float64 `json:"b"`
+	A float64 `json:"a"`
+}
+
+// Transformational and color properties of the ThreeJS directional light
+type Light struct {
+	Position Position `json:"position"`
+	Rotation Rotation `json:"rotation"`
+	Color    Color    `json:"color"`
 }
 
 // Primitive VRM blend shape value. By default, a float64
 type BlendShape float64
 
+// Names of VRM preset blend shapes
+const (
+	BlendShapeNeutral   = "Neutral"
+	BlendShapeA         = "A"
+	BlendShapeI         = "I"
+	BlendShapeU         = "U"
+	BlendShapeE         = "E"
+	BlendShapeO         = "O"
+	BlendShapeBlink     = "Blink"
+	BlendShapeBlinkL    = "Blink_L"
+	BlendShapeBlinkR    = "Blink_R"
+	BlendShapeJoy       = "Joy"
+	BlendShapeAngry     = "Angry"
+	BlendShapeSorrow    = "Sorrow"
+	BlendShapeFun       = "Fun"
+	BlendShapeLookUp    = "LookUp"
+	BlendShapeLookDown  = "LookDown"
+	BlendShapeLookLeft  = "LookLeft"
+	BlendShapeLookRight = "LookRight"
+)
+
+// Names of brow blend shapes. Brows are not part of the VRM presets,
+// so these are ARKit's, named the same way ARKitBlendShapeName does.
+const (
+	BlendShapeBrowInnerUp  = "BrowInnerUp"
+	BlendShapeBrowDownL    = "BrowDown_L"
+	BlendShapeBrowDownR    = "BrowDown_R"
+	BlendShapeBrowOuterUpL = "BrowOuterUp_L"
+	BlendShapeBrowOuterUpR = "BrowOuterUp_R"
+)
+
+// Convert an ARKit blend shape name into the naming Facemotion3D and iFacialMocap use,
+// e.g. "eyeBlinkLeft" or "EyeBlinkLeft" to "EyeBlink_L", so every receiver gives a model the same keys.
+func ARKitBlendShapeName(name string) string {
+
+	if name == "" {
+		return name
+	}
+
+	name = strings.ToUpper(name[0:1]) + name[1:]
+
+	if strings.HasSuffix(name, "Left") {
+		return strings.TrimSuffix(name, "Left") + "_L"
+	}
+	if strings.HasSuffix(name, "Right") {
+		return strings.TrimSuffix(name, "Right") + "_R"
+	}
+
+	return name
+
+}
+
 type BlendShapes map[string]BlendShape
 
 type Bones map[string]Bone
 
+type Trackers map[string]Tracker
+
+// Snapshot of VRM transformation data at a single point in time
+type Frame struct {
+	Root        Root        `json:"root"`
+	Bones       Bones       `json:"bones"`
+	BlendShapes BlendShapes `json:"blend_shapes"`
+	Trackers    Trackers    `json:"trackers"`
+}
+
 // VRM model for 3D-transformation purposes
 type VRM struct {
+	Root             Root        `json:"root"`         // Root transform of the whole model
 	Bones            Bones       `json:"bones"`        // All poseable bones, based off of Unity's HumanBodyBones
 	BlendShapes      BlendShapes `json:"blend_shapes"` // All blend shapes, unique to VRM model
+	Trackers         Trackers    `json:"trackers"`     // All tracked devices, by serial number, for attaching props
+	rootMutex        *sync.RWMutex
 	bonesMutex       *sync.RWMutex
 	blendShapesMutex *sync.RWMutex
+	trackersMutex    *sync.RWMutex
 	readCallback     func(vrm *VRM)
 }
 
@@ -73,10 +178,19 @@ type VRM struct {
 func NewVRM() VRM {
 
 	return VRM{
+		Root: Root{
+			Rotation: Rotation{
+				Quaternion: QuaternionRotation{W: 1},
+			},
+			Scale: Position{X: 1, Y: 1, Z: 1},
+		},
 		Bones:            make(Bones),
 		BlendShapes:      make(BlendShapes),
+		Trackers:         make(Trackers),
+		rootMutex:        &sync.RWMutex{},
 		bonesMutex:       &sync.RWMutex{},
 		blendShapesMutex: &sync.RWMutex{},
+		trackersMutex:    &sync.RWMutex{},
 	}
 
 }
@@ -85,26 +199,69 @@ func NewVRM() VRM {
 func (v *VRM) Read(callback func(vrm *VRM)) {
 
 	// Lock VRM for safe reading
+	v.rootMutex.RLock()
 	v.bonesMutex.RLock()
 	v.blendShapesMutex.RLock()
+	v.trackersMutex.RLock()
+	defer v.rootMutex.RUnlock()
 	defer v.bonesMutex.RUnlock()
 	defer v.blendShapesMutex.RUnlock()
+	defer v.trackersMutex.RUnlock()
 
 	// Process VRM data
 	callback(v)
 
 }
 
+func (v *VRM) WriteRoot(value Root) {
+
+	// Lock VRM for safe writing
+	v.rootMutex.Lock()
+	defer v.rootMutex.Unlock()
+
+	value.Rotation.Quaternion.X = value.Rotation.Quaternion.X * -1
+
+	// Modify VRM root
+	v.Root = value
+
+}
+
+// Convert a bone from Unity's coordinates into how WriteBone stores it, e.g. for frames that are written as-is
+func StoredBone(value Bone) Bone {
+	value.Rotation.Quaternion.X = value.Rotation.Quaternion.X * -1
+	return value
+}
+
 func (v *VRM) WriteBone(key string, value Bone) {
 
 	// Lock VRM for safe writing
 	v.bonesMutex.Lock()
 	defer v.bonesMutex.Unlock()
 
+	// Modify VRM bones
+	v.Bones[key] = StoredBone(value)
+
+}
+
+// Write only the rotation of a bone, given in right-handed coordinates
+func (v *VRM) WriteRotation(key string, rotation QuaternionRotation) {
+	v.WriteBone(key, Bone{
+		Rotation: Rotation{
+			Quaternion: rotation.Unity(),
+		},
+	})
+}
+
+func (v *VRM) WriteTracker(key string, value Tracker) {
+
+	// Lock VRM for safe writing
+	v.trackersMutex.Lock()
+	defer v.trackersMutex.Unlock()
+
 	value.Rotation.Quaternion.X = value.Rotation.Quaternion.X * -1
 
-	// Modify VRM bones
-	v.Bones[key] = value
+	// Modify VRM trackers
+	v.Trackers[key] = value
 
 }
 
@@ -118,3 +275,111 @@ func (v *VRM) WriteBlendShape(key string, value BlendShape) {
 	v.BlendShapes[key] = value
 
 }
+
+// Write many blend shapes at once, so readers never see only some of them applied
+func (v *VRM) WriteBlendShapes(values BlendShapes) {
+
+	// Lock VRM for safe writing
+	v.blendShapesMutex.Lock()
+	defer v.blendShapesMutex.Unlock()
+
+	// Modify VRM blend shapes
+	for key, value := range values {
+		v.BlendShapes[key] = value
+	}
+
+}
+
+// Copy the current VRM data into a frame
+func (v *VRM) Frame() Frame {
+
+	frame := Frame{
+		Bones:       make(Bones),
+		BlendShapes: make(BlendShapes),
+		Trackers:    make(Trackers),
+	}
+
+	v.Read(func(vrm *VRM) {
+
+		frame.Root = vrm.Root
+
+		for key, value := range vrm.Bones {
+			frame.Bones[key] = value
+		}
+
+		for key, value := range vrm.BlendShapes {
+			frame.BlendShapes[key] = value
+		}
+
+		for key, value := range vrm.Trackers {
+			frame.Trackers[key] = value
+		}
+
+	})
+
+	return frame
+
+}
+
+// Write a whole frame at once, as-is. Unlike other writes, no conversion is done,
+// as frames are copied from VRM data that was already converted.
+func (v *VRM) WriteFrame(frame Frame) {
+
+	// Lock VRM for safe writing
+	v.rootMutex.Lock()
+	v.bonesMutex.Lock()
+	v.blendShapesMutex.Lock()
+	v.trackersMutex.Lock()
+	defer v.rootMutex.Unlock()
+	defer v.bonesMutex.Unlock()
+	defer v.blendShapesMutex.Unlock()
+	defer v.trackersMutex.Unlock()
+
+	// Modify all VRM data
+	v.Root = frame.Root
+
+	for key, value := range frame.Bones {
+		v.Bones[key] = value
+	}
+
+	for key, value := range frame.BlendShapes {
+		v.BlendShapes[key] = value
+	}
+
+	for key, value := range frame.Trackers {
+		v.Trackers[key] = value
+	}
+
+}
+
+// Replace the whole VRM with a frame, as-is. Unlike WriteFrame, anything not in the frame is removed.
+func (v *VRM) ReplaceFrame(frame Frame) {
+
+	// Lock VRM for safe writing
+	v.rootMutex.Lock()
+	v.bonesMutex.Lock()
+	v.blendShapesMutex.Lock()
+	v.trackersMutex.Lock()
+	defer v.rootMutex.Unlock()
+	defer v.bonesMutex.Unlock()
+	defer v.blendShapesMutex.Unlock()
+	defer v.trackersMutex.Unlock()
+
+	v.Root = frame.Root
+
+	v.Bones = make(Bones, len(frame.Bones))
+	for key, value := range frame.Bones {
+		v.Bones[key] = value
+	}
+
+	v.BlendShapes = make(BlendShapes, len(frame.BlendShapes))
+	for key, value := range frame.BlendShapes {
+		v.BlendShapes[key] = value
+	}
+
+	v.Trackers = make(Trackers, len(frame.Trackers))
+	for key, value := range frame.Trackers {
+		v.Trackers[key] = value
+	}
+
+}
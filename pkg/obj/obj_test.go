@@ -0,0 +1,43 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package obj
+
+import "testing"
+
+func TestARKitBlendShapeName(t *testing.T) {
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "eyeBlinkLeft", want: "EyeBlink_L"},
+		{name: "EyeBlinkRight", want: "EyeBlink_R"},
+		{name: "mouthSmileLeft", want: "MouthSmile_L"},
+		{name: "BrowInnerUp", want: "BrowInnerUp"},
+		{name: "jawOpen", want: "JawOpen"},
+		{name: "EyeBlink_L", want: "EyeBlink_L"},
+		{name: "", want: ""},
+	}
+
+	for _, test := range tests {
+		if got := ARKitBlendShapeName(test.name); got != test.want {
+			t.Errorf("ARKitBlendShapeName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+}
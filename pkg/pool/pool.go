@@ -19,6 +19,7 @@ package pool
 
 import (
 	"log"
+	"sync"
 
 	"github.com/thatpix3l/fntwo/pkg/helper"
 )
@@ -26,7 +27,9 @@ import (
 type updateCallback func(client *Client)
 
 type Pool struct {
-	clients map[string]Client // List of clients waiting for data
+	clients      map[string]Client // List of clients waiting for data
+	clientsMutex *sync.Mutex       // Guards clients, as they come and go from their own goroutines
+	updateMutex  *sync.Mutex       // Runs one update at a time, so each client only has one writer
 }
 
 type Client struct {
@@ -44,30 +47,57 @@ func (p Pool) Create(process updateCallback) {
 		callback: process,
 		poolPtr:  &p,
 	}
+
+	p.clientsMutex.Lock()
 	p.clients[clientID] = newClient
+	p.clientsMutex.Unlock()
 
 }
 
 // Delete client
 func (c Client) Delete() {
+
+	c.poolPtr.clientsMutex.Lock()
 	delete(c.poolPtr.clients, c.ID)
+	c.poolPtr.clientsMutex.Unlock()
+
 }
 
 // Log the amount of clients in pool
 func (p Pool) LogCount() {
+
+	p.clientsMutex.Lock()
+	defer p.clientsMutex.Unlock()
+
 	log.Printf("Number of clients: %d", len(p.clients))
+
 }
 
 // Run each client's update callback
 func (p Pool) Update() {
+
+	p.updateMutex.Lock()
+	defer p.updateMutex.Unlock()
+
+	// Callbacks may delete their own client, so run them on a copy
+	p.clientsMutex.Lock()
+	clients := make([]Client, 0, len(p.clients))
 	for _, c := range p.clients {
+		clients = append(clients, c)
+	}
+	p.clientsMutex.Unlock()
+
+	for _, c := range clients {
 		c.callback(&c)
 	}
+
 }
 
 // Return a new pool manager
 func New() Pool {
 	return Pool{
-		clients: make(map[string]Client),
+		clients:      make(map[string]Client),
+		clientsMutex: &sync.Mutex{},
+		updateMutex:  &sync.Mutex{},
 	}
 }
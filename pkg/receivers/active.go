@@ -0,0 +1,128 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package receivers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+// Receiver picked as the source of motion data, which may be switched while others read from it
+type Active struct {
+	switchMutex sync.Mutex                  // Held while switching, so only one switch happens at a time
+	mutex       sync.RWMutex                // Guards everything below
+	name        string                      // Name of the active receiver
+	receiver    Receiver                    // Active receiver
+	overlays    []func(obj.Frame) obj.Frame // Laid over the output, in order, e.g. mouth shapes from text-to-speech
+}
+
+// Pick a receiver by name as the active one
+func NewActive(receiverMap map[string]Receiver, name string) (*Active, error) {
+
+	receiver, ok := receiverMap[name]
+	if !ok {
+		return nil, fmt.Errorf("receiver \"%s\" does not exist", name)
+	}
+
+	return &Active{
+		name:     name,
+		receiver: receiver,
+	}, nil
+
+}
+
+// Name of the active receiver, along with the receiver itself
+func (a *Active) Get() (string, Receiver) {
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a.name, a.receiver
+
+}
+
+// Name of the active receiver
+func (a *Active) Name() string {
+
+	name, _ := a.Get()
+	return name
+
+}
+
+// Lay something over the output of whichever receiver is active, without writing to the receiver itself
+func (a *Active) AddOverlay(overlay func(frame obj.Frame) obj.Frame) {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.overlays = append(a.overlays, overlay)
+
+}
+
+// Copy of the active receiver's VRM data, with every overlay laid over it.
+// This is what gets sent to clients, recorded and forwarded.
+func (a *Active) Frame() obj.Frame {
+
+	a.mutex.RLock()
+	receiver := a.receiver
+	overlays := a.overlays
+	a.mutex.RUnlock()
+
+	frame := receiver.VRM().Frame()
+	for _, overlay := range overlays {
+		frame = overlay(frame)
+	}
+
+	return frame
+
+}
+
+// Stop the active receiver and start another in its place.
+// If the other receiver fails to start, the previous one is started again and stays active.
+func (a *Active) Switch(ctx context.Context, name string, receiver Receiver) error {
+
+	a.switchMutex.Lock()
+	defer a.switchMutex.Unlock()
+
+	_, previous := a.Get()
+
+	// Stop the current receiver first, so the new one can use the same addresses if it's the same type
+	previous.Stop()
+
+	if err := receiver.Start(ctx); err != nil {
+
+		if err := previous.Start(ctx); err != nil {
+			log.Println(err)
+		}
+
+		return err
+
+	}
+
+	a.mutex.Lock()
+	a.name = name
+	a.receiver = receiver
+	a.mutex.Unlock()
+
+	return nil
+
+}
@@ -0,0 +1,344 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bvh
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/obj"
+	"github.com/thatpix3l/fntwo/pkg/receivers"
+)
+
+// Plays back BVH motion capture files
+type Receiver struct {
+	*receivers.Base
+}
+
+var (
+	// Joint names used by common BVH sources, e.g. Mixamo, CMU and Daz, mapped to Unity's HumanBodyBones.
+	// Names are compared in lowercase, without separators or a namespace like "mixamorig:".
+	jointNames = map[string]string{
+		"hips":       "Hips",
+		"pelvis":     "Hips",
+		"spine":      "Spine",
+		"lowerback":  "Spine",
+		"abdomen":    "Spine",
+		"spine1":     "Chest",
+		"chest":      "Chest",
+		"spine2":     "UpperChest",
+		"upperchest": "UpperChest",
+		"chest2":     "UpperChest",
+		"neck":       "Neck",
+		"head":       "Head",
+		"lefteye":    "LeftEye",
+		"righteye":   "RightEye",
+	}
+
+	// Same as above, but for either side of the body. "%" is replaced by each side's prefixes.
+	sidedJointNames = map[string]string{
+		"%shoulder":   "Shoulder",
+		"%collar":     "Shoulder",
+		"%clavicle":   "Shoulder",
+		"%arm":        "UpperArm",
+		"%upperarm":   "UpperArm",
+		"%shldr":      "UpperArm",
+		"%forearm":    "LowerArm",
+		"%lowerarm":   "LowerArm",
+		"%hand":       "Hand",
+		"%upleg":      "UpperLeg",
+		"%upperleg":   "UpperLeg",
+		"%thigh":      "UpperLeg",
+		"%leg":        "LowerLeg",
+		"%lowerleg":   "LowerLeg",
+		"%shin":       "LowerLeg",
+		"%foot":       "Foot",
+		"%toebase":    "Toes",
+		"%toes":       "Toes",
+		"%toe":        "Toes",
+		"%handthumb":  "Thumb",
+		"%handindex":  "Index",
+		"%handmiddle": "Middle",
+		"%handring":   "Ring",
+		"%handpinky":  "Little",
+		"%thumb":      "Thumb",
+		"%index":      "Index",
+		"%mid":        "Middle",
+		"%ring":       "Ring",
+		"%pinky":      "Little",
+	}
+
+	// Prefixes used for each side of the body
+	sidePrefixes = map[string][]string{
+		"Left":  {"left", "l"},
+		"Right": {"right", "r"},
+	}
+
+	// Finger joints are numbered from the palm outwards
+	fingerBones = map[string]string{
+		"1": "Proximal",
+		"2": "Intermediate",
+		"3": "Distal",
+	}
+)
+
+func init() {
+
+	for pattern, bone := range sidedJointNames {
+		for side, prefixes := range sidePrefixes {
+			for _, prefix := range prefixes {
+
+				name := strings.ReplaceAll(pattern, "%", prefix)
+
+				switch bone {
+				case "Thumb", "Index", "Middle", "Ring", "Little":
+					for number, fingerBone := range fingerBones {
+						jointNames[name+number] = side + bone + fingerBone
+
+						// Also accept Unity's own names, e.g. from files we exported
+						jointNames[strings.ToLower(side+bone+fingerBone)] = side + bone + fingerBone
+					}
+				default:
+					jointNames[name] = side + bone
+				}
+
+			}
+		}
+	}
+
+	receivers.Register("BVH", New)
+
+}
+
+// Name of the HumanBodyBone a BVH joint maps to, if any
+func boneName(jointName string) (string, bool) {
+
+	// Drop namespaces, e.g. "mixamorig:Hips"
+	if i := strings.LastIndex(jointName, ":"); i >= 0 {
+		jointName = jointName[i+1:]
+	}
+
+	normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "", ".", "").Replace(jointName))
+
+	name, ok := jointNames[normalized]
+	return name, ok
+
+}
+
+// Retarget every frame of a BVH motion onto VRM bones.
+// Joints that don't map to a bone have their rotation carried into their children instead.
+func retarget(m *motion, scale float64) ([]obj.Frame, error) {
+
+	// Nearest ancestor of each joint that maps to a bone, or -1 for none
+	bones := make([]string, len(m.joints))
+	mappedParent := make([]int, len(m.joints))
+	used := make(map[string]bool)
+	for i, j := range m.joints {
+
+		// Only the first joint mapping to a bone is used, e.g. CMU's "LowerBack" before "Spine"
+		if name, ok := boneName(j.name); ok && !used[name] {
+			bones[i] = name
+			used[name] = true
+		}
+
+		mappedParent[i] = -1
+		if j.parent >= 0 {
+			if bones[j.parent] != "" {
+				mappedParent[i] = j.parent
+			} else {
+				mappedParent[i] = mappedParent[j.parent]
+			}
+		}
+
+	}
+
+	if !used["Hips"] {
+		return nil, errors.New("no hips joint found in BVH hierarchy")
+	}
+
+	frames := make([]obj.Frame, len(m.frames))
+	global := make([]obj.QuaternionRotation, len(m.joints))
+	for f, values := range m.frames {
+
+		frame := obj.Frame{
+			Root: obj.Root{
+				Rotation: obj.Rotation{Quaternion: obj.QuaternionRotation{W: 1}},
+				Scale:    obj.Position{X: 1, Y: 1, Z: 1},
+			},
+			Bones:       make(obj.Bones),
+			BlendShapes: make(obj.BlendShapes),
+			Trackers:    make(obj.Trackers),
+		}
+
+		// Parents always come before their children, so each global rotation can be built from the last
+		for i, j := range m.joints {
+
+			rotation, position := m.local(j, values)
+
+			global[i] = rotation
+			if j.parent >= 0 {
+				global[i] = global[j.parent].Multiply(rotation)
+			}
+
+			if bones[i] == "" {
+				continue
+			}
+
+			local := global[i]
+			if mappedParent[i] >= 0 {
+				local = global[mappedParent[i]].Conjugate().Multiply(global[i])
+			}
+
+			// BVH is right-handed, where the body faces positive Z.
+			// Frames are written as-is, so also store the bone the same way obj.VRM.WriteBone would.
+			bone := obj.StoredBone(obj.Bone{
+				Rotation: obj.Rotation{Quaternion: local.Unity()},
+			})
+
+			// Only the hips move around, and they do so in meters
+			if bones[i] == "Hips" {
+				bone.Position = obj.Position{
+					X: position.X * scale,
+					Y: position.Y * scale,
+					Z: -position.Z * scale,
+				}
+			}
+
+			frame.Bones[bones[i]] = bone
+
+		}
+
+		frames[f] = frame
+
+	}
+
+	return frames, nil
+
+}
+
+// Load and retarget a BVH file
+func load(path string, scale float64) ([]obj.Frame, float64, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	m, err := parse(file)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(m.frames) == 0 {
+		return nil, 0, errors.New("BVH file has no frames")
+	}
+
+	frames, err := retarget(m, scale)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return frames, m.frameTime, nil
+
+}
+
+// Load the configured BVH file, returning a function that plays it back until the context is cancelled
+func (b *Receiver) prepare(ctx context.Context) (func(), error) {
+
+	appConfig := b.AppConfig
+
+	if appConfig.BVHFile == "" {
+		return nil, errors.New("no BVH file to play back")
+	}
+
+	frames, frameTime, err := load(appConfig.BVHFile, appConfig.BVHScale)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Playing back %d frames of BVH motion from %s", len(frames), appConfig.BVHFile)
+
+	return func() {
+		b.play(ctx, frames, frameTime)
+	}, nil
+
+}
+
+// Play back frames until the context is cancelled
+func (b *Receiver) play(ctx context.Context, frames []obj.Frame, frameTime float64) {
+
+	appConfig := b.AppConfig
+
+	ticker := time.NewTicker(time.Duration(1e9 / appConfig.ModelUpdateFrequency))
+	defer ticker.Stop()
+
+	started := time.Now()
+	duration := frameTime * float64(len(frames)-1)
+	for {
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Time in the motion, which either wraps around or holds the last frame
+		position := time.Since(started).Seconds()
+		if position > duration {
+			if appConfig.BVHLoop && duration > 0 {
+				position = math.Mod(position, duration)
+			} else {
+				position = duration
+			}
+		}
+
+		b.Received("")
+
+		// Interpolate between the frames on either side
+		i := int(position / frameTime)
+		if i >= len(frames)-1 {
+			b.VRM().WriteFrame(frames[len(frames)-1])
+			continue
+		}
+		b.VRM().WriteFrame(frames[i].Lerp(frames[i+1], position/frameTime-float64(i)))
+
+	}
+
+}
+
+// Start receiving in background
+func (b *Receiver) Start(ctx context.Context) error {
+	return b.Run(ctx, b.prepare)
+}
+
+// Create a new receiver.
+// Plays back BVH motion capture files, retargeted onto the VRM's bones.
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
+
+	return &Receiver{
+		Base: receivers.NewBase(env.AppConfig, instance),
+	}, nil
+
+}
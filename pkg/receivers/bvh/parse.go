@@ -0,0 +1,313 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bvh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+// Single joint in a BVH hierarchy
+type joint struct {
+	name     string
+	parent   int          // Index of parent joint, or -1 for the root
+	offset   obj.Position // Offset from the parent joint, in BVH units
+	channels []string     // Channel names, in the order their values appear in each frame
+	first    int          // Index of this joint's first channel value in each frame
+}
+
+// Parsed BVH motion capture file
+type motion struct {
+	joints    []joint
+	frames    [][]float64 // Channel values of every frame
+	frameTime float64     // Seconds between each frame
+}
+
+// Splits a BVH file into whitespace-separated tokens
+type tokenizer struct {
+	scanner *bufio.Scanner
+}
+
+// Next token, or an error if there are none left
+func (t *tokenizer) next() (string, error) {
+
+	if !t.scanner.Scan() {
+		if err := t.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.ErrUnexpectedEOF
+	}
+
+	return t.scanner.Text(), nil
+
+}
+
+// Next token, which must be the given keyword
+func (t *tokenizer) expect(keyword string) error {
+
+	token, err := t.next()
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(token, keyword) {
+		return fmt.Errorf("expected \"%s\", found \"%s\"", keyword, token)
+	}
+
+	return nil
+
+}
+
+// Next token, parsed as a number
+func (t *tokenizer) float() (float64, error) {
+
+	token, err := t.next()
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(token, 64)
+
+}
+
+// Next three tokens, parsed as a position
+func (t *tokenizer) position() (obj.Position, error) {
+
+	var values [3]float64
+	for i := range values {
+
+		value, err := t.float()
+		if err != nil {
+			return obj.Position{}, err
+		}
+		values[i] = value
+
+	}
+
+	return obj.Position{X: values[0], Y: values[1], Z: values[2]}, nil
+
+}
+
+// Parse a joint's body, after its name, including all of its children
+func (m *motion) parseJoint(t *tokenizer, name string, parent int, channelCount *int) error {
+
+	if err := t.expect("{"); err != nil {
+		return err
+	}
+
+	index := len(m.joints)
+	m.joints = append(m.joints, joint{
+		name:   name,
+		parent: parent,
+		first:  *channelCount,
+	})
+
+	for {
+
+		token, err := t.next()
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToUpper(token) {
+		case "OFFSET":
+
+			offset, err := t.position()
+			if err != nil {
+				return err
+			}
+			m.joints[index].offset = offset
+
+		case "CHANNELS":
+
+			count, err := t.float()
+			if err != nil {
+				return err
+			}
+
+			if count < 0 || count != math.Trunc(count) {
+				return fmt.Errorf("invalid channel count in joint \"%s\"", name)
+			}
+
+			for i := 0; i < int(count); i++ {
+
+				channel, err := t.next()
+				if err != nil {
+					return err
+				}
+				m.joints[index].channels = append(m.joints[index].channels, strings.ToLower(channel))
+
+			}
+			*channelCount += int(count)
+
+		case "JOINT":
+
+			childName, err := t.next()
+			if err != nil {
+				return err
+			}
+
+			if err := m.parseJoint(t, childName, index, channelCount); err != nil {
+				return err
+			}
+
+		case "END":
+
+			// End sites only mark where the last bone ends, which isn't needed
+			if err := t.expect("Site"); err != nil {
+				return err
+			}
+			for token != "}" {
+				if token, err = t.next(); err != nil {
+					return err
+				}
+			}
+
+		case "}":
+			return nil
+
+		default:
+			return fmt.Errorf("unexpected \"%s\" in joint \"%s\"", token, name)
+		}
+
+	}
+
+}
+
+// Parse a whole BVH file, with its hierarchy followed by its motion
+func parse(reader io.Reader) (*motion, error) {
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	scanner.Split(bufio.ScanWords)
+	t := &tokenizer{scanner: scanner}
+
+	m := &motion{}
+
+	if err := t.expect("HIERARCHY"); err != nil {
+		return nil, err
+	}
+
+	if err := t.expect("ROOT"); err != nil {
+		return nil, err
+	}
+
+	rootName, err := t.next()
+	if err != nil {
+		return nil, err
+	}
+
+	channelCount := 0
+	if err := m.parseJoint(t, rootName, -1, &channelCount); err != nil {
+		return nil, err
+	}
+
+	// Only a single root is supported, so the motion must come next
+	if err := t.expect("MOTION"); err != nil {
+		return nil, err
+	}
+
+	if err := t.expect("Frames:"); err != nil {
+		return nil, err
+	}
+
+	frameCount, err := t.float()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.expect("Frame"); err != nil {
+		return nil, err
+	}
+	if err := t.expect("Time:"); err != nil {
+		return nil, err
+	}
+
+	if m.frameTime, err = t.float(); err != nil {
+		return nil, err
+	}
+
+	if m.frameTime <= 0 {
+		return nil, errors.New("frame time must be more than zero")
+	}
+
+	for i := 0; i < int(frameCount); i++ {
+
+		frame := make([]float64, channelCount)
+		for c := range frame {
+
+			value, err := t.float()
+
+			// Some exporters write fewer frames than they say, so keep whatever was complete
+			if err == io.ErrUnexpectedEOF {
+				return m, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			frame[c] = value
+
+		}
+
+		m.frames = append(m.frames, frame)
+
+	}
+
+	return m, nil
+
+}
+
+// Rotation and position of a joint in a single frame, relative to its parent.
+// Rotation channels are applied in the order they are listed, from the parent down.
+func (m *motion) local(j joint, frame []float64) (obj.QuaternionRotation, obj.Position) {
+
+	rotation := obj.QuaternionRotation{W: 1}
+	position := j.offset
+
+	for i, channel := range j.channels {
+
+		value := frame[j.first+i]
+
+		switch channel {
+		case "xposition":
+			position.X = value
+		case "yposition":
+			position.Y = value
+		case "zposition":
+			position.Z = value
+		case "xrotation":
+			rotation = rotation.Multiply(obj.QuaternionFromAxisAngle(obj.Position{X: 1}, value*math.Pi/180))
+		case "yrotation":
+			rotation = rotation.Multiply(obj.QuaternionFromAxisAngle(obj.Position{Y: 1}, value*math.Pi/180))
+		case "zrotation":
+			rotation = rotation.Multiply(obj.QuaternionFromAxisAngle(obj.Position{Z: 1}, value*math.Pi/180))
+		}
+
+	}
+
+	return rotation.Normalize(), position
+
+}
@@ -0,0 +1,218 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package bvh
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+const (
+	// Hips with a child joint, where the channels of each are in different orders
+	testHierarchy = `HIERARCHY
+ROOT Hips
+{
+	OFFSET 0 90 0
+	CHANNELS 6 Xposition Yposition Zposition Zrotation Xrotation Yrotation
+	JOINT Spine
+	{
+		OFFSET 0 10 0
+		CHANNELS 3 Yrotation Xrotation Zrotation
+		End Site
+		{
+			OFFSET 0 5 0
+		}
+	}
+}
+`
+)
+
+func TestParse(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		file      string
+		joints    []joint
+		frames    [][]float64
+		frameTime float64
+		wantErr   bool
+	}{
+		{
+			name: "channels keep their order",
+			file: testHierarchy + `MOTION
+Frames: 2
+Frame Time: 0.033333
+1 2 3 10 20 30 40 50 60
+4 5 6 0 0 0 0 0 0
+`,
+			joints: []joint{
+				{name: "Hips", parent: -1, offset: obj.Position{Y: 90}, channels: []string{"xposition", "yposition", "zposition", "zrotation", "xrotation", "yrotation"}},
+				{name: "Spine", parent: 0, offset: obj.Position{Y: 10}, channels: []string{"yrotation", "xrotation", "zrotation"}, first: 6},
+			},
+			frames: [][]float64{
+				{1, 2, 3, 10, 20, 30, 40, 50, 60},
+				{4, 5, 6, 0, 0, 0, 0, 0, 0},
+			},
+			frameTime: 0.033333,
+		},
+		{
+			name: "fewer frames than said keeps whole ones",
+			file: testHierarchy + `MOTION
+Frames: 3
+Frame Time: 0.5
+1 2 3 10 20 30 40 50 60
+4 5 6
+`,
+			frames:    [][]float64{{1, 2, 3, 10, 20, 30, 40, 50, 60}},
+			frameTime: 0.5,
+		},
+		{
+			name:    "no hierarchy",
+			file:    "MOTION\nFrames: 0\nFrame Time: 0.1\n",
+			wantErr: true,
+		},
+		{
+			name:    "no motion",
+			file:    testHierarchy,
+			wantErr: true,
+		},
+		{
+			name:    "zero frame time",
+			file:    testHierarchy + "MOTION\nFrames: 1\nFrame Time: 0\n",
+			wantErr: true,
+		},
+		{
+			name:    "frame value not a number",
+			file:    testHierarchy + "MOTION\nFrames: 1\nFrame Time: 0.1\n1 2 three 4 5 6 7 8 9\n",
+			wantErr: true,
+		},
+		{
+			name:    "negative channel count",
+			file:    "HIERARCHY\nROOT Hips\n{\nOFFSET 0 0 0\nCHANNELS -3\n}\nMOTION\nFrames: 1\nFrame Time: 0.1\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown keyword in joint",
+			file:    "HIERARCHY\nROOT Hips\n{\nROTATION 0 0 0\n}\n",
+			wantErr: true,
+		},
+		{
+			name:    "joint never closed",
+			file:    "HIERARCHY\nROOT Hips\n{\nOFFSET 0 0 0\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			m, err := parse(strings.NewReader(test.file))
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.joints != nil && !reflect.DeepEqual(m.joints, test.joints) {
+				t.Errorf("joints = %+v, want %+v", m.joints, test.joints)
+			}
+			if !reflect.DeepEqual(m.frames, test.frames) {
+				t.Errorf("frames = %v, want %v", m.frames, test.frames)
+			}
+			if m.frameTime != test.frameTime {
+				t.Errorf("frame time = %v, want %v", m.frameTime, test.frameTime)
+			}
+
+		})
+	}
+
+}
+
+func TestLocal(t *testing.T) {
+
+	m, err := parse(strings.NewReader(testHierarchy + "MOTION\nFrames: 0\nFrame Time: 0.1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	axis := func(x, y, z, degrees float64) obj.QuaternionRotation {
+		return obj.QuaternionFromAxisAngle(obj.Position{X: x, Y: y, Z: z}, degrees*math.Pi/180)
+	}
+
+	tests := []struct {
+		name     string
+		joint    int
+		frame    []float64
+		rotation obj.QuaternionRotation
+		position obj.Position
+	}{
+		{
+			name:     "no rotation keeps the offset",
+			joint:    1,
+			frame:    make([]float64, 9),
+			rotation: obj.QuaternionRotation{W: 1},
+			position: obj.Position{Y: 10},
+		},
+		{
+			name:     "position channels replace the offset",
+			joint:    0,
+			frame:    []float64{1, 2, 3, 0, 0, 0, 0, 0, 0},
+			rotation: obj.QuaternionRotation{W: 1},
+			position: obj.Position{X: 1, Y: 2, Z: 3},
+		},
+		{
+			name:     "rotations applied in the listed Z, X, Y order",
+			joint:    0,
+			frame:    []float64{0, 0, 0, 10, 20, 30, 0, 0, 0},
+			rotation: axis(0, 0, 1, 10).Multiply(axis(1, 0, 0, 20)).Multiply(axis(0, 1, 0, 30)),
+			position: obj.Position{},
+		},
+		{
+			name:     "rotations applied in the listed Y, X, Z order",
+			joint:    1,
+			frame:    []float64{0, 0, 0, 0, 0, 0, 40, 50, 60},
+			rotation: axis(0, 1, 0, 40).Multiply(axis(1, 0, 0, 50)).Multiply(axis(0, 0, 1, 60)),
+			position: obj.Position{Y: 10},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			rotation, position := m.local(m.joints[test.joint], test.frame)
+
+			dot := rotation.X*test.rotation.X + rotation.Y*test.rotation.Y + rotation.Z*test.rotation.Z + rotation.W*test.rotation.W
+			if math.Abs(math.Abs(dot)-1) > 1e-9 {
+				t.Errorf("rotation = %+v, want %+v", rotation, test.rotation)
+			}
+			if position != test.position {
+				t.Errorf("position = %+v, want %+v", position, test.position)
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,273 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package compositor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/obj"
+	"github.com/thatpix3l/fntwo/pkg/receivers"
+)
+
+const (
+	Name     = "Compositor" // Type the compositor is registered as
+	wildcard = "*"          // Mask key matching every bone or blend shape not listed by name
+)
+
+// Combines several receivers at once, according to the mask in the scene config
+type Receiver struct {
+	*receivers.Base
+	sceneConfig *config.Scene
+	receiverMap map[string]receivers.Receiver // Every receiver by name, to pick sources from
+
+	stateMutex sync.Mutex           // Guards everything below
+	running    map[string]bool      // Receivers started by the compositor, by name
+	failed     map[string]time.Time // Receivers that failed to start, by when they last failed, which are tried again every so often
+}
+
+func init() {
+	receivers.Register(Name, New)
+}
+
+// Receiver a single bone or blend shape comes from
+func source(mask map[string]string, name string, fallback string) string {
+
+	if receiver, ok := mask[name]; ok {
+		return receiver
+	}
+
+	if receiver, ok := mask[wildcard]; ok {
+		return receiver
+	}
+
+	return fallback
+
+}
+
+// Build a single frame out of many, picking each part from the receiver the mask says it comes from
+func compose(mask config.Compositor, frames map[string]obj.Frame) obj.Frame {
+
+	composed := obj.Frame{
+		Root:        obj.NewVRM().Root,
+		Bones:       make(obj.Bones),
+		BlendShapes: make(obj.BlendShapes),
+		Trackers:    make(obj.Trackers),
+	}
+
+	if frame, ok := frames[mask.Default]; ok {
+		composed.Root = frame.Root
+		composed.Trackers = frame.Trackers
+	}
+
+	for receiver, frame := range frames {
+
+		for name, bone := range frame.Bones {
+			if source(mask.Bones, name, mask.Default) == receiver {
+				composed.Bones[name] = bone
+			}
+		}
+
+		for name, value := range frame.BlendShapes {
+			if source(mask.BlendShapes, name, mask.Default) == receiver {
+				composed.BlendShapes[name] = value
+			}
+		}
+
+	}
+
+	return composed
+
+}
+
+// Check that every receiver in a mask exists, and isn't a compositor itself
+func Validate(mask config.Compositor, receiverMap map[string]receivers.Receiver) error {
+
+	for _, name := range mask.Receivers() {
+
+		receiver, ok := receiverMap[name]
+		if !ok {
+			return fmt.Errorf("receiver \"%s\" does not exist", name)
+		}
+
+		if _, ok := receiver.(*Receiver); ok {
+			return fmt.Errorf("compositor can't use a compositor as a source")
+		}
+
+	}
+
+	return nil
+
+}
+
+// Start receivers the mask now uses and stop the ones it no longer does, returning the first error from starting any.
+// Must be called with stateMutex held.
+func (c *Receiver) reconcile(ctx context.Context, mask config.Compositor) error {
+
+	wanted := make(map[string]bool)
+	for _, name := range mask.Receivers() {
+		if receiver, ok := c.receiverMap[name]; ok {
+			if _, ok := receiver.(*Receiver); !ok {
+				wanted[name] = true
+			}
+		}
+	}
+
+	for name := range c.running {
+		if !wanted[name] {
+			log.Printf("Compositor stopped using %s", name)
+			c.receiverMap[name].Stop()
+			delete(c.running, name)
+		}
+	}
+
+	for name := range c.failed {
+		if !wanted[name] {
+			delete(c.failed, name)
+		}
+	}
+
+	var firstErr error
+	for name := range wanted {
+
+		if c.running[name] {
+			continue
+		}
+
+		// Don't retry a receiver that just failed on every tick
+		if failed, ok := c.failed[name]; ok && time.Since(failed) < receivers.RetryInterval {
+			continue
+		}
+
+		log.Printf("Compositor started using %s", name)
+		if err := c.receiverMap[name].Start(ctx); err != nil {
+			c.failed[name] = time.Now()
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		c.running[name] = true
+		delete(c.failed, name)
+
+	}
+
+	return firstErr
+
+}
+
+// Start every receiver the mask uses, returning a function that composites until the context is cancelled
+func (c *Receiver) composite(ctx context.Context) (func(), error) {
+
+	c.stateMutex.Lock()
+	c.running = make(map[string]bool)
+	c.failed = make(map[string]time.Time)
+	err := c.reconcile(ctx, c.sceneConfig.ReadCompositor())
+	c.stateMutex.Unlock()
+
+	if err != nil {
+		c.stopSources()
+		return nil, err
+	}
+
+	log.Println("Compositing model transformation data from many receivers")
+
+	return func() {
+
+		defer c.stopSources()
+
+		ticker := time.NewTicker(time.Duration(1e9 / c.AppConfig.ModelUpdateFrequency))
+		defer ticker.Stop()
+
+		// When any source last received data, so the compositor is only connected while its sources are
+		var lastReceived time.Time
+		for {
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// The mask may be changed through the API at any time
+			mask := c.sceneConfig.ReadCompositor()
+
+			c.stateMutex.Lock()
+			if err := c.reconcile(ctx, mask); err != nil {
+				log.Println(err)
+			}
+			frames := make(map[string]obj.Frame)
+			received := false
+			for name := range c.running {
+
+				receiver := c.receiverMap[name]
+				frames[name] = receiver.VRM().Frame()
+
+				if status := receiver.Status(); status.LastFrame != nil && status.LastFrame.After(lastReceived) {
+					lastReceived = *status.LastFrame
+					received = true
+				}
+
+			}
+			c.stateMutex.Unlock()
+
+			// Replaced as a whole, so parts a source no longer owns don't keep their last values
+			c.VRM().ReplaceFrame(compose(mask, frames))
+			if received {
+				c.Received("")
+			}
+
+		}
+
+	}, nil
+
+}
+
+// Stop every receiver the compositor started
+func (c *Receiver) stopSources() {
+
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	for name := range c.running {
+		c.receiverMap[name].Stop()
+	}
+	c.running = nil
+
+}
+
+// Start receiving in background
+func (c *Receiver) Start(ctx context.Context) error {
+	return c.Run(ctx, c.composite)
+}
+
+// Create a new receiver.
+// Runs several receivers at once, combining them according to the mask in the scene config.
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
+
+	return &Receiver{
+		Base:        receivers.NewBase(env.AppConfig, instance),
+		sceneConfig: env.SceneConfig,
+		receiverMap: env.Receivers,
+	}, nil
+
+}
@@ -0,0 +1,120 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package compositor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+func TestCompose(t *testing.T) {
+
+	root := func(x float64) obj.Root {
+		return obj.Root{Position: obj.Position{X: x}}
+	}
+	bone := func(x float64) obj.Bone {
+		return obj.Bone{Position: obj.Position{X: x}}
+	}
+
+	frames := map[string]obj.Frame{
+		"face": {
+			Root:        root(1),
+			Bones:       obj.Bones{"Head": bone(1), "Neck": bone(1)},
+			BlendShapes: obj.BlendShapes{"Blink": 1, "A": 1},
+			Trackers:    obj.Trackers{"face": {Kind: obj.TrackerGeneric}},
+		},
+		"body": {
+			Root:        root(2),
+			Bones:       obj.Bones{"Head": bone(2), "Hips": bone(2)},
+			BlendShapes: obj.BlendShapes{"Blink": 0.5},
+			Trackers:    obj.Trackers{"body": {Kind: obj.TrackerHMD}},
+		},
+	}
+
+	tests := []struct {
+		name string
+		mask config.Compositor
+		want obj.Frame
+	}{
+		{
+			name: "default takes everything, including root and trackers",
+			mask: config.Compositor{Default: "body"},
+			want: obj.Frame{
+				Root:        root(2),
+				Bones:       obj.Bones{"Head": bone(2), "Hips": bone(2)},
+				BlendShapes: obj.BlendShapes{"Blink": 0.5},
+				Trackers:    obj.Trackers{"body": {Kind: obj.TrackerHMD}},
+			},
+		},
+		{
+			name: "listed bones and blend shapes come from their own receiver",
+			mask: config.Compositor{
+				Default:     "body",
+				Bones:       map[string]string{"Head": "face"},
+				BlendShapes: map[string]string{"A": "face"},
+			},
+			want: obj.Frame{
+				Root:        root(2),
+				Bones:       obj.Bones{"Head": bone(1), "Hips": bone(2)},
+				BlendShapes: obj.BlendShapes{"Blink": 0.5, "A": 1},
+				Trackers:    obj.Trackers{"body": {Kind: obj.TrackerHMD}},
+			},
+		},
+		{
+			name: "wildcard replaces the default for anything not listed",
+			mask: config.Compositor{
+				Default:     "body",
+				Bones:       map[string]string{"Hips": "body", wildcard: "face"},
+				BlendShapes: map[string]string{wildcard: "face"},
+			},
+			want: obj.Frame{
+				Root:        root(2),
+				Bones:       obj.Bones{"Head": bone(1), "Neck": bone(1), "Hips": bone(2)},
+				BlendShapes: obj.BlendShapes{"Blink": 1, "A": 1},
+				Trackers:    obj.Trackers{"body": {Kind: obj.TrackerHMD}},
+			},
+		},
+		{
+			name: "missing default leaves the root at rest",
+			mask: config.Compositor{
+				Default: "nothing",
+				Bones:   map[string]string{"Hips": "body"},
+			},
+			want: obj.Frame{
+				Root:        obj.NewVRM().Root,
+				Bones:       obj.Bones{"Hips": bone(2)},
+				BlendShapes: obj.BlendShapes{},
+				Trackers:    obj.Trackers{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			if got := compose(test.mask, frames); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("compose() = %+v, want %+v", got, test.want)
+			}
+
+		})
+	}
+
+}
@@ -18,6 +18,7 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package facemotion3d
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -32,16 +33,25 @@ import (
 	"github.com/westphae/quaternion"
 )
 
-var (
-	fm3dReceiver  *receivers.MotionReceiver
-	serverEnabled = true
-	currentConn   net.Conn
+const (
+	devicePort = "49993" // Port the Facemotion3D app listens on for streaming requests
+)
 
+var (
 	matchFrames = regexp.MustCompile(`(.*___FACEMOTION3D(.*?))___FACEMOTION3D`)
 )
 
+// Receives face data from the Facemotion3D app
+type Receiver struct {
+	*receivers.Base
+}
+
+func init() {
+	receivers.Register("Facemotion3D", New)
+}
+
 // Parse a full frame of motion data.
-func parseFrame(frameStr string) {
+func (f *Receiver) parseFrame(frameStr string) {
 
 	// All data is separated by the delimiter "|"
 	payload := strings.Split(frameStr, "|")
@@ -83,7 +93,7 @@ func parseFrame(frameStr string) {
 			// Cast value to type obj.BlendShape
 			blendShape := obj.BlendShape(value)
 
-			fm3dReceiver.VRM.WriteBlendShape(key, blendShape)
+			f.VRM().WriteBlendShape(key, blendShape)
 
 		}
 
@@ -138,7 +148,7 @@ func parseFrame(frameStr string) {
 				},
 			}
 
-			fm3dReceiver.VRM.WriteBone(key, bone)
+			f.VRM().WriteBone(key, bone)
 
 		}
 
@@ -168,82 +178,161 @@ func sendThroughTCP(address string) error {
 
 }
 
-func listenTCP() {
+// Wait for a duration, returning false if the context was cancelled first
+func wait(ctx context.Context, duration time.Duration) bool {
 
-	// Listen for new connections
-	listener, err := net.Listen("tcp", fm3dReceiver.AppConfig.FM3DListen.String())
-	if err != nil {
-		log.Print(err)
-		return
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
-	defer listener.Close()
 
-	for serverEnabled {
+}
 
-		log.Printf("Telling device at \"%s\" to send motion Facemotion3D data through TCP", fm3dReceiver.AppConfig.FM3DDevice.IP())
-		if err := sendThroughTCP(fm3dReceiver.AppConfig.FM3DDevice.IP() + ":49993"); err != nil {
+// Tell the device to send data, retrying every 3 seconds until it works or the context is cancelled
+func (f *Receiver) requestData(ctx context.Context, device config.Address) bool {
 
-			log.Print("Facemotion3D source error, waiting 3 seconds")
-			time.Sleep(3 * time.Second)
-			continue
+	for {
+
+		log.Printf("Telling device at \"%s\" to send motion Facemotion3D data through TCP", device.IP())
+		err := sendThroughTCP(device.IP() + ":" + devicePort)
+		if err == nil {
+			return true
+		}
 
+		f.Fail(err)
+		log.Print("Facemotion3D source error, waiting 3 seconds")
+		if !wait(ctx, 3*time.Second) {
+			return false
 		}
 
-		// Accept new connection
-		log.Print("Waiting for Facemotion3D client")
-		if conn, err := listener.Accept(); err != nil {
-			log.Println(err)
-		} else {
-			currentConn = conn
+	}
+
+}
+
+// Read frames of data from a single client, until it disconnects or the context is cancelled
+func (f *Receiver) readFrames(ctx context.Context, conn net.Conn) {
+
+	defer conn.Close()
+
+	// Reading blocks, so close the connection to stop early
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-finished:
+		}
+	}()
+
+	var liveFrames string
+	for {
+
+		// Repeatedly read from connection new face data
+		connBuf := make([]byte, 8192)
+		_, err := conn.Read(connBuf)
+		if err != nil {
+			return
+		}
+		liveFrames += string(connBuf)
+		liveFrames = strings.ReplaceAll(liveFrames, "\x00", "")
+
+		matchedFrames := matchFrames.FindStringSubmatch(liveFrames)
+		if len(matchedFrames) == 0 {
+			continue
 		}
 
-		log.Print("Accepted new Facemotion3D client")
+		allBeforeDelimiter := matchedFrames[1]
+		latestFrame := matchedFrames[2]
+
+		// Parse the frame of data
+		f.parseFrame(latestFrame)
+		f.Received(conn.RemoteAddr().String())
+
+		// Prune the frame of data that we just worked on, so we do not work with it on next iteration
+		liveFrames = strings.ReplaceAll(liveFrames, allBeforeDelimiter, "")
+
+	}
+
+}
+
+// Bind to the Facemotion3D address, returning a function that tells the device to send data
+// and accepts clients until the context is cancelled
+func (f *Receiver) listenTCP(ctx context.Context) (func(), error) {
+
+	address := f.Listen(f.AppConfig.FM3DListen)
+	device := f.Device(f.AppConfig.FM3DDevice)
+
+	// Listen for new connections
+	listener, err := net.Listen("tcp", address.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+
+		defer listener.Close()
+
+		// Accepting blocks, so close the listener to stop early
+		go func() {
+			<-ctx.Done()
+			listener.Close()
+		}()
+
+		// The device may not be ready yet, e.g. the app isn't open, so keep asking until it is
+		if !f.requestData(ctx, device) {
+			return
+		}
 
-		var liveFrames string
 		for {
 
-			// Repeatedly read from connection new face data
-			connBuf := make([]byte, 8192)
-			_, err := currentConn.Read(connBuf)
+			// Accept new connection
+			log.Print("Waiting for Facemotion3D client")
+			conn, err := listener.Accept()
 			if err != nil {
-				break
-			}
-			liveFrames += string(connBuf)
-			liveFrames = strings.ReplaceAll(liveFrames, "\x00", "")
 
-			matchedFrames := matchFrames.FindStringSubmatch(liveFrames)
-			if len(matchedFrames) == 0 {
+				if ctx.Err() != nil {
+					return
+				}
+
+				f.Fail(err)
+				if !wait(ctx, 3*time.Second) {
+					return
+				}
 				continue
-			}
 
-			allBeforeDelimiter := matchedFrames[1]
-			latestFrame := matchedFrames[2]
+			}
 
-			// Parse the frame of data
-			parseFrame(latestFrame)
+			log.Print("Accepted new Facemotion3D client")
+			f.readFrames(ctx, conn)
 
-			// Prune the frame of data that we just worked on, so we do not work with it on next iteration
-			liveFrames = strings.ReplaceAll(liveFrames, allBeforeDelimiter, "")
+			log.Print("Facemotion3D source disconnected, waiting 3 seconds")
+			if !wait(ctx, 3*time.Second) || !f.requestData(ctx, device) {
+				return
+			}
 
 		}
 
-		log.Print("Facemotion3D source disconnected, waiting 3 seconds")
-		time.Sleep(3 * time.Second)
-
-	}
+	}, nil
 
 }
 
-func stopListening() {
-	serverEnabled = false
-	currentConn.Close()
+// Start receiving in background
+func (f *Receiver) Start(ctx context.Context) error {
+	return f.Run(ctx, f.listenTCP)
 }
 
-// Create a new MotionReceiver.
+// Create a new receiver.
 // Uses the Facemotion3D app for face data. Internally, TCP is used to communicate with a device.
-func New(appConfig *config.App) *receivers.MotionReceiver {
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
 
-	fm3dReceiver = receivers.New(appConfig, listenTCP, stopListening)
-	return fm3dReceiver
+	return &Receiver{
+		Base: receivers.NewBase(env.AppConfig, instance),
+	}, nil
 
 }
@@ -0,0 +1,281 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/obj"
+	"github.com/thatpix3l/fntwo/pkg/receivers"
+	"github.com/thatpix3l/fntwo/pkg/receivers/compositor"
+)
+
+const (
+	Name = "Failover" // Type the failover is registered as
+)
+
+// Follows the most preferred receiver that is still sending data, switching back once a more preferred one recovers
+type Receiver struct {
+	*receivers.Base
+	receiverMap map[string]receivers.Receiver // Every receiver by name, to pick sources from
+
+	stateMutex sync.Mutex      // Guards everything below
+	started    map[string]bool // Receivers started by the failover, by name
+}
+
+func init() {
+	receivers.Register(Name, New)
+}
+
+// Check that every receiver to pick from exists, and doesn't start other receivers itself
+func Validate(names []string, receiverMap map[string]receivers.Receiver) error {
+
+	if len(names) == 0 {
+		return errors.New("no receivers to fail over between")
+	}
+
+	for _, name := range names {
+
+		receiver, ok := receiverMap[name]
+		if !ok {
+			return fmt.Errorf("receiver \"%s\" does not exist", name)
+		}
+
+		switch receiver.(type) {
+		case *Receiver, *compositor.Receiver:
+			return fmt.Errorf("failover can't use \"%s\" as a source, as it starts other receivers itself", name)
+		}
+
+	}
+
+	return nil
+
+}
+
+// Start every receiver that isn't already running, returning how many are running and the first error from starting any.
+// Must be called with stateMutex held.
+func (f *Receiver) startSources(ctx context.Context, names []string) (int, error) {
+
+	running := 0
+	var firstErr error
+	for _, name := range names {
+
+		source := f.receiverMap[name]
+		if source.Status().Running {
+			running++
+			continue
+		}
+
+		if err := source.Start(ctx); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		f.started[name] = true
+		running++
+
+	}
+
+	return running, firstErr
+
+}
+
+// Stop every receiver the failover started
+func (f *Receiver) stopSources() {
+
+	f.stateMutex.Lock()
+	defer f.stateMutex.Unlock()
+
+	for name := range f.started {
+		f.receiverMap[name].Stop()
+	}
+	f.started = nil
+
+}
+
+// Most preferred receiver that sent data within the timeout, if any
+func (f *Receiver) pick(names []string, timeout time.Duration) (string, bool) {
+
+	for _, name := range names {
+
+		status := f.receiverMap[name].Status()
+		if status.Running && status.LastFrame != nil && time.Since(*status.LastFrame) <= timeout {
+			return name, true
+		}
+
+	}
+
+	return "", false
+
+}
+
+// Add everything only found in the previous frame back to a frame, in its rest pose.
+// This way, blend shapes and bones the new receiver doesn't drive are faded out, instead of left where they were.
+func withRest(frame obj.Frame, previous obj.Frame) obj.Frame {
+
+	for name, bone := range previous.Bones {
+		if _, ok := frame.Bones[name]; !ok {
+			bone.Rotation.Quaternion = obj.QuaternionRotation{W: 1}
+			frame.Bones[name] = bone
+		}
+	}
+
+	for name := range previous.BlendShapes {
+		if _, ok := frame.BlendShapes[name]; !ok {
+			frame.BlendShapes[name] = 0
+		}
+	}
+
+	return frame
+
+}
+
+// Start every receiver to pick from, returning a function that follows the most preferred one until the context is cancelled
+func (f *Receiver) follow(ctx context.Context) (func(), error) {
+
+	// Copied, as the config may change while running
+	names := append([]string(nil), f.AppConfig.Failover...)
+	timeout := time.Duration(f.AppConfig.FailoverTimeout * float64(time.Second))
+	crossfade := f.AppConfig.FailoverCrossfade
+
+	if err := Validate(names, f.receiverMap); err != nil {
+		return nil, err
+	}
+
+	f.stateMutex.Lock()
+	f.started = make(map[string]bool)
+	running, err := f.startSources(ctx, names)
+	f.stateMutex.Unlock()
+
+	// Some receivers failing is fine, as long as there's anything to follow
+	if running == 0 {
+		f.stopSources()
+		return nil, err
+	}
+	if err != nil {
+		log.Println(err)
+	}
+
+	log.Printf("Failing over between %v", names)
+
+	return func() {
+
+		defer f.stopSources()
+
+		ticker := time.NewTicker(time.Duration(1e9 / f.AppConfig.ModelUpdateFrequency))
+		defer ticker.Stop()
+
+		var (
+			active   string    // Receiver being followed
+			previous obj.Frame // Frame written right before switching, to crossfade from
+			switched time.Time // When the last switch happened
+			retried  = time.Now()
+		)
+
+		for {
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// Receivers that failed to start, or stopped on their own, get another chance every so often
+			if time.Since(retried) >= receivers.RetryInterval {
+
+				f.stateMutex.Lock()
+				if _, err := f.startSources(ctx, names); err != nil {
+					log.Println(err)
+				}
+				f.stateMutex.Unlock()
+
+				retried = time.Now()
+
+			}
+
+			// Nothing is sending data, so hold whatever was written last
+			picked, ok := f.pick(names, timeout)
+			if !ok {
+				continue
+			}
+
+			if picked != active {
+
+				if active == "" {
+					log.Printf("Failover following %s", picked)
+				} else {
+					log.Printf("Failover switching from %s to %s", active, picked)
+					previous = f.VRM().Frame()
+					switched = time.Now()
+				}
+
+				active = picked
+
+			}
+
+			frame := f.receiverMap[active].VRM().Frame()
+
+			// Blend from wherever the model was when switching, if the switch was recent enough
+			if !switched.IsZero() {
+
+				frame = withRest(frame, previous)
+
+				if progress := time.Since(switched).Seconds(); crossfade > 0 && progress < crossfade {
+					frame = previous.Lerp(frame, progress/crossfade)
+				} else {
+
+					// Fully blended, and whatever was left behind is now at rest, so there's nothing left to do
+					previous = obj.Frame{}
+					switched = time.Time{}
+
+				}
+
+			}
+
+			f.VRM().WriteFrame(frame)
+			f.Received("")
+
+		}
+
+	}, nil
+
+}
+
+// Start receiving in background
+func (f *Receiver) Start(ctx context.Context) error {
+	return f.Run(ctx, f.follow)
+}
+
+// Create a new receiver.
+// Follows the first receiver in the configured list that is sending data, crossfading whenever it switches.
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
+
+	return &Receiver{
+		Base:        receivers.NewBase(env.AppConfig, instance),
+		receiverMap: env.Receivers,
+	}, nil
+
+}
@@ -0,0 +1,98 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package failover
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+func TestWithRest(t *testing.T) {
+
+	identity := obj.QuaternionRotation{W: 1}
+	turned := obj.QuaternionRotation{Y: 1}
+
+	tests := []struct {
+		name     string
+		frame    obj.Frame
+		previous obj.Frame
+		want     obj.Frame
+	}{
+		{
+			name: "missing bones and blend shapes are put at rest",
+			frame: obj.Frame{
+				Bones:       obj.Bones{"Head": {Rotation: obj.Rotation{Quaternion: turned}}},
+				BlendShapes: obj.BlendShapes{"A": 1},
+			},
+			previous: obj.Frame{
+				Bones: obj.Bones{
+					"Head":  {Rotation: obj.Rotation{Quaternion: identity}},
+					"Spine": {Position: obj.Position{Y: 1}, Rotation: obj.Rotation{Quaternion: turned}},
+				},
+				BlendShapes: obj.BlendShapes{"A": 0, "Blink": 0.8},
+			},
+			want: obj.Frame{
+				Bones: obj.Bones{
+					"Head":  {Rotation: obj.Rotation{Quaternion: turned}},
+					"Spine": {Position: obj.Position{Y: 1}, Rotation: obj.Rotation{Quaternion: identity}},
+				},
+				BlendShapes: obj.BlendShapes{"A": 1, "Blink": 0},
+			},
+		},
+		{
+			name: "nothing missing",
+			frame: obj.Frame{
+				Bones:       obj.Bones{"Head": {Rotation: obj.Rotation{Quaternion: turned}}},
+				BlendShapes: obj.BlendShapes{"A": 1},
+			},
+			previous: obj.Frame{
+				Bones:       obj.Bones{"Head": {Rotation: obj.Rotation{Quaternion: identity}}},
+				BlendShapes: obj.BlendShapes{"A": 0},
+			},
+			want: obj.Frame{
+				Bones:       obj.Bones{"Head": {Rotation: obj.Rotation{Quaternion: turned}}},
+				BlendShapes: obj.BlendShapes{"A": 1},
+			},
+		},
+		{
+			name: "nothing before",
+			frame: obj.Frame{
+				Bones:       obj.Bones{"Head": {Rotation: obj.Rotation{Quaternion: turned}}},
+				BlendShapes: obj.BlendShapes{},
+			},
+			want: obj.Frame{
+				Bones:       obj.Bones{"Head": {Rotation: obj.Rotation{Quaternion: turned}}},
+				BlendShapes: obj.BlendShapes{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			frame := withRest(test.frame, test.previous)
+			if !reflect.DeepEqual(frame, test.want) {
+				t.Errorf("withRest() = %+v, want %+v", frame, test.want)
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,219 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package idle
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/obj"
+	"github.com/thatpix3l/fntwo/pkg/receivers"
+)
+
+const (
+	blinkClose   = 0.06 // Seconds it takes to close the eyes when blinking
+	blinkOpen    = 0.12 // Seconds it takes to open the eyes again
+	doubleBlink  = 0.15 // Chance of blinking again right after a blink
+	saccadeYaw   = 8.0  // Degrees the eyes look left or right at most
+	saccadePitch = 4.0  // Degrees the eyes look up or down at most
+	saccadeSpeed = 0.04 // Seconds it takes the eyes to move to where they look next
+)
+
+var (
+	// Rotation axes, in right-handed coordinates where the body faces positive Z
+	pitchAxis = obj.Position{X: 1}
+	yawAxis   = obj.Position{Y: 1}
+	rollAxis  = obj.Position{Z: 1}
+)
+
+// Generates idle motion, for when nothing else is tracking
+type Receiver struct {
+	*receivers.Base
+}
+
+func init() {
+	receivers.Register("Idle", New)
+}
+
+// State of the eyes, which jump between where they look
+type eyes struct {
+	from     [2]float64 // Yaw and pitch the eyes are moving from, in degrees
+	to       [2]float64 // Yaw and pitch the eyes are moving to, in degrees
+	moved    float64    // Time the eyes started moving, in seconds
+	nextMove float64    // Time the eyes move next, in seconds
+}
+
+// State of the eyelids
+type eyelids struct {
+	started   float64 // Time the current blink started, in seconds
+	nextBlink float64 // Time of the next blink, in seconds
+}
+
+// Random time between half and one and a half times the average
+func jitter(average float64) float64 {
+	return average * (0.5 + rand.Float64())
+}
+
+// Rotation from angles in degrees, applied as yaw, then pitch, then roll
+func eulerRotation(pitch float64, yaw float64, roll float64) obj.QuaternionRotation {
+
+	return obj.QuaternionFromAxisAngle(yawAxis, yaw*math.Pi/180).
+		Multiply(obj.QuaternionFromAxisAngle(pitchAxis, pitch*math.Pi/180)).
+		Multiply(obj.QuaternionFromAxisAngle(rollAxis, roll*math.Pi/180))
+
+}
+
+// Smooth noise from -1 to 1, made of a few sine waves that rarely line up
+func noise(t float64, seed float64) float64 {
+	return (math.Sin(t*0.31+seed) + math.Sin(t*0.53+seed*2.1)*0.6 + math.Sin(t*0.97+seed*3.7)*0.3) / 1.9
+}
+
+// How closed the eyes are during a blink, from 0 to 1
+func (e *eyelids) update(t float64, appConfig *config.App) float64 {
+
+	if t >= e.nextBlink {
+		e.started = e.nextBlink
+		if rand.Float64() < doubleBlink {
+			e.nextBlink = t + blinkClose + blinkOpen + 0.1
+		} else {
+			e.nextBlink = t + jitter(appConfig.IdleBlinkInterval)
+		}
+	}
+
+	elapsed := t - e.started
+	switch {
+	case elapsed < 0:
+		return 0
+	case elapsed < blinkClose:
+		return elapsed / blinkClose
+	case elapsed < blinkClose+blinkOpen:
+		return 1 - (elapsed-blinkClose)/blinkOpen
+	default:
+		return 0
+	}
+
+}
+
+// Yaw and pitch of the eyes, in degrees
+func (e *eyes) update(t float64, appConfig *config.App) (float64, float64) {
+
+	// Jump somewhere new, mostly close to looking straight ahead
+	if t >= e.nextMove {
+		e.from = e.current(t)
+		e.to = [2]float64{
+			(rand.Float64()*2 - 1) * saccadeYaw * rand.Float64(),
+			(rand.Float64()*2 - 1) * saccadePitch * rand.Float64(),
+		}
+		e.moved = t
+		e.nextMove = t + jitter(appConfig.IdleSaccadeInterval)
+	}
+
+	current := e.current(t)
+	return current[0], current[1]
+
+}
+
+// Where the eyes are looking at a given time, while moving or not
+func (e *eyes) current(t float64) [2]float64 {
+
+	progress := math.Min((t-e.moved)/saccadeSpeed, 1)
+
+	return [2]float64{
+		e.from[0] + (e.to[0]-e.from[0])*progress,
+		e.from[1] + (e.to[1]-e.from[1])*progress,
+	}
+
+}
+
+// Animate until the context is cancelled
+func (i *Receiver) animate(ctx context.Context) {
+
+	appConfig := i.AppConfig
+
+	log.Println("Generating idle model transformation data")
+
+	ticker := time.NewTicker(time.Duration(1e9 / appConfig.ModelUpdateFrequency))
+	defer ticker.Stop()
+
+	started := time.Now()
+	seed := rand.Float64() * 100
+	lids := eyelids{nextBlink: jitter(appConfig.IdleBlinkInterval)}
+	gaze := eyes{}
+
+	for {
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		t := time.Since(started).Seconds()
+
+		// Breathing in bends the spine and chest back a little, and breathing out bends them forward
+		breath := math.Sin(t*appConfig.IdleBreathRate/60*2*math.Pi) * appConfig.IdleBreathDepth
+		i.VRM().WriteRotation("Spine", eulerRotation(-breath*0.4, 0, 0))
+		i.VRM().WriteRotation("Chest", eulerRotation(-breath*0.6, 0, 0))
+
+		// Head slowly drifts around
+		sway := appConfig.IdleSway
+		i.VRM().WriteRotation("Head", eulerRotation(noise(t, seed)*sway*0.6, noise(t, seed+10)*sway, noise(t, seed+20)*sway*0.4))
+		i.VRM().WriteRotation("Neck", eulerRotation(noise(t, seed+30)*sway*0.3, noise(t, seed+40)*sway*0.5, 0))
+
+		// Arms rest at the sides, instead of in a T-pose. The left arm points towards positive X.
+		i.VRM().WriteRotation("LeftUpperArm", eulerRotation(0, 0, -appConfig.IdleArmAngle))
+		i.VRM().WriteRotation("RightUpperArm", eulerRotation(0, 0, appConfig.IdleArmAngle))
+		i.VRM().WriteRotation("LeftLowerArm", eulerRotation(0, -10, 0))
+		i.VRM().WriteRotation("RightLowerArm", eulerRotation(0, 10, 0))
+
+		// Both eyes look the same way. Looking up is a negative pitch.
+		yaw, pitch := gaze.update(t, appConfig)
+		i.VRM().WriteRotation("LeftEye", eulerRotation(-pitch, yaw, 0))
+		i.VRM().WriteRotation("RightEye", eulerRotation(-pitch, yaw, 0))
+
+		i.VRM().WriteBlendShapes(obj.BlendShapes{
+			obj.BlendShapeBlink: obj.BlendShape(lids.update(t, appConfig)),
+		})
+		i.Received("")
+
+	}
+
+}
+
+// Start receiving in background
+func (i *Receiver) Start(ctx context.Context) error {
+	return i.Run(ctx, func(ctx context.Context) (func(), error) {
+		return func() {
+			i.animate(ctx)
+		}, nil
+	})
+}
+
+// Create a new receiver.
+// Generates breathing, blinking, swaying and eye movement, for when nothing else is tracking.
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
+
+	return &Receiver{
+		Base: receivers.NewBase(env.AppConfig, instance),
+	}, nil
+
+}
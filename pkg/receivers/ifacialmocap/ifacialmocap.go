@@ -0,0 +1,268 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package ifacialmocap
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/obj"
+	"github.com/thatpix3l/fntwo/pkg/receivers"
+	"github.com/westphae/quaternion"
+)
+
+const (
+	devicePort = "49983"                                               // Port the iFacialMocap app listens on for the start handshake
+	handshake  = "iFacialMocap_sahuasouryya9218sauhuiayeta91555dy3719" // Message that tells the iFacialMocap app to start sending data
+)
+
+// Receives face data from the iFacialMocap app
+type Receiver struct {
+	lastFrame int64 // Unix time in nanoseconds of when the last frame was received. First, so it's aligned for atomic access.
+	*receivers.Base
+}
+
+func init() {
+	receivers.Register("iFacialMocap", New)
+}
+
+// Convert an iFacialMocap bone or blend shape name from camelCase to PascalCase, e.g. "eyeBlink_L" to "EyeBlink_L".
+// This is the same naming Facemotion3D uses, so a model gets the same keys from either app.
+func pascalCase(key string) string {
+	return strings.ToUpper(key[0:1]) + key[1:]
+}
+
+// Parse a full frame of motion data.
+func (i *Receiver) parseFrame(frameStr string) {
+
+	// All data is separated by the delimiter "|"
+	payload := strings.Split(frameStr, "|")
+
+	// For each data in the frame...
+	for _, payloadStr := range payload {
+
+		// Skip empty data
+		if payloadStr == "" {
+			continue
+		}
+
+		// If we're working with a bone (we know because it will contain an "#" symbol)...
+		if strings.Contains(payloadStr, "#") {
+
+			// The name and values are separated by a single "#"
+			keyVal := strings.SplitN(payloadStr, "#", 2)
+
+			// Remove "=" char in key, convert from camelCase to PascalCase
+			key := strings.ReplaceAll(keyVal[0], "=", "")
+			if key == "" {
+				continue
+			}
+			key = pascalCase(key)
+
+			// For each value for the current bone, convert it from a string to a float and store it in boneValues
+			var boneValues []float64
+			for _, v := range strings.Split(keyVal[1], ",") {
+
+				rawFloat, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					log.Print(err)
+					continue
+				}
+
+				boneValues = append(boneValues, rawFloat)
+
+			}
+
+			// Every bone starts with its Euler rotation, in degrees
+			if len(boneValues) < 3 {
+				continue
+			}
+
+			boneQuat := quaternion.FromEuler(
+				boneValues[0]*math.Pi/180,
+				boneValues[1]*math.Pi/180,
+				-boneValues[2]*math.Pi/180,
+			)
+
+			bone := obj.Bone{
+				Rotation: obj.Rotation{
+					Quaternion: obj.QuaternionRotation{
+						X: boneQuat.X,
+						Y: boneQuat.Y,
+						Z: boneQuat.Z,
+						W: boneQuat.W,
+					},
+				},
+			}
+
+			i.VRM().WriteBone(key, bone)
+			continue
+
+		}
+
+		// Otherwise, it's a blend shape. Newer versions separate the name and value with "&", older ones with "-"
+		separator := strings.LastIndex(payloadStr, "&")
+		if separator == -1 {
+			separator = strings.LastIndex(payloadStr, "-")
+		}
+		if separator < 1 {
+			continue
+		}
+
+		key := payloadStr[:separator]
+
+		// Skip iFacialMocap-specific blend shapes
+		if key == "hapihapi" {
+			continue
+		}
+
+		// Blend shape value
+		value, err := strconv.ParseFloat(payloadStr[separator+1:], 64)
+		if err != nil {
+			continue
+		}
+
+		// The blend shape values are in integer format from 0 to 100, but it has to be in decimal format from 0 to 1
+		i.VRM().WriteBlendShape(pascalCase(key), obj.BlendShape(value/100))
+
+	}
+
+}
+
+// Tell a device with address to start sending iFacialMocap data to us
+func sendHandshake(address string) error {
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprint(conn, handshake); err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// Repeatedly tell the device to send data, for as long as it isn't sending any
+func (i *Receiver) requestData(ctx context.Context, device config.Address) {
+
+	ticker := time.NewTicker(3 * time.Second)
+	defer ticker.Stop()
+
+	for {
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if time.Since(time.Unix(0, atomic.LoadInt64(&i.lastFrame))) > 3*time.Second {
+
+			log.Printf("Telling device at \"%s\" to send iFacialMocap motion data", device.IP())
+			if err := sendHandshake(device.IP() + ":" + devicePort); err != nil {
+				i.Fail(err)
+			}
+
+		}
+
+	}
+
+}
+
+// Bind to the iFacialMocap address and tell the device to send data,
+// returning a function that receives frames until the context is cancelled
+func (i *Receiver) listenUDP(ctx context.Context) (func(), error) {
+
+	address := i.Listen(i.AppConfig.IFMListen)
+	device := i.Device(i.AppConfig.IFMDevice)
+
+	// Listen for frames of motion data
+	conn, err := net.ListenPacket("udp", address.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// The first handshake is sent right away, so an unreachable device is reported to whoever started the receiver
+	log.Printf("Telling device at \"%s\" to send iFacialMocap motion data", device.IP())
+	if err := sendHandshake(device.IP() + ":" + devicePort); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	log.Printf("Listening for iFacialMocap model transformation data on %s", address)
+
+	return func() {
+
+		defer conn.Close()
+
+		// Stop listening once cancelled
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+
+		go i.requestData(ctx, device)
+
+		connBuf := make([]byte, 8192)
+		for {
+
+			// Each packet is a full frame of data
+			n, addr, err := conn.ReadFrom(connBuf)
+			if err != nil {
+				if ctx.Err() == nil {
+					i.Fail(err)
+				}
+				break
+			}
+			i.Received(addr.String())
+
+			atomic.StoreInt64(&i.lastFrame, time.Now().UnixNano())
+			i.parseFrame(string(connBuf[:n]))
+
+		}
+
+	}, nil
+
+}
+
+// Start receiving in background
+func (i *Receiver) Start(ctx context.Context) error {
+	return i.Run(ctx, i.listenUDP)
+}
+
+// Create a new receiver.
+// Uses the iFacialMocap app for face data. Internally, UDP is used to communicate with a device.
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
+
+	return &Receiver{
+		Base: receivers.NewBase(env.AppConfig, instance),
+	}, nil
+
+}
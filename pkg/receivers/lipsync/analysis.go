@@ -0,0 +1,243 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lipsync
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+const (
+	windowDuration = 0.032 // Seconds of audio analyzed at once, roughly
+	preEmphasis    = 0.97  // How much lower frequencies are dampened, so formants stand out
+	envelopeWidth  = 150.0 // Width in Hz of the smoothing used to find the spectral envelope
+	loudnessRange  = 30.0  // Decibels above the threshold where the mouth is fully open
+	vowelSpread    = 0.25  // How far off in log frequency a formant can be and still sound like a vowel
+
+	// Ranges in Hz to search for the first two formants
+	f1Min = 250.0
+	f1Max = 1000.0
+	f2Min = 800.0
+	f2Max = 3000.0
+)
+
+// First two formants of a vowel, in Hz
+type vowel struct {
+	blendShape string
+	f1         float64
+	f2         float64
+}
+
+var (
+	// Rough formants of each Japanese vowel, as VRM's mouth shapes are based off of them
+	vowels = []vowel{
+		{blendShape: obj.BlendShapeA, f1: 800, f2: 1200},
+		{blendShape: obj.BlendShapeI, f1: 300, f2: 2300},
+		{blendShape: obj.BlendShapeU, f1: 350, f2: 1400},
+		{blendShape: obj.BlendShapeE, f1: 500, f2: 1900},
+		{blendShape: obj.BlendShapeO, f1: 500, f2: 850},
+	}
+)
+
+// Turns audio into mouth shapes, keeping whatever samples are left over between calls
+type analyzer struct {
+	sampleRate int
+	window     []float64          // Hann window, which is also the size of each analysis
+	pending    []float64          // Samples not analyzed yet
+	weights    map[string]float64 // Smoothed weight of each vowel
+}
+
+// In-place radix-2 fast Fourier transform. Length must be a power of two.
+func fft(values []complex128) {
+
+	n := len(values)
+
+	// Reorder by bit-reversed index
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			values[i], values[j] = values[j], values[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even := values[start+k]
+				odd := values[start+k+size/2] * w
+				values[start+k] = even + odd
+				values[start+k+size/2] = even - odd
+				w *= step
+			}
+
+		}
+
+	}
+
+}
+
+// Create a new analyzer for audio of the given sample rate
+func newAnalyzer(sampleRate int) *analyzer {
+
+	// Smallest power of two that covers the window duration
+	size := 1
+	for float64(size) < float64(sampleRate)*windowDuration {
+		size <<= 1
+	}
+
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size-1))
+	}
+
+	return &analyzer{
+		sampleRate: sampleRate,
+		window:     window,
+		weights:    make(map[string]float64),
+	}
+
+}
+
+// Frequency in Hz of the loudest point of the spectrum within a range
+func peak(envelope []float64, binWidth float64, min float64, max float64) float64 {
+
+	best := -1
+	for i := int(min / binWidth); i <= int(max/binWidth) && i < len(envelope); i++ {
+		if best < 0 || envelope[i] > envelope[best] {
+			best = i
+		}
+	}
+
+	return float64(best) * binWidth
+
+}
+
+// Find how loud the samples are, in decibels, and their first two formants, in Hz
+func (a *analyzer) formants(samples []float64) (float64, float64, float64) {
+
+	size := len(a.window)
+	values := make([]complex128, size)
+
+	var sum float64
+	previous := 0.0
+	for i, sample := range samples {
+		sum += sample * sample
+		values[i] = complex((sample-preEmphasis*previous)*a.window[i], 0)
+		previous = sample
+	}
+
+	loudness := 10 * math.Log10(sum/float64(size)+1e-12)
+
+	fft(values)
+
+	// Smooth the spectrum so only its overall shape is left, where the peaks are the formants
+	binWidth := float64(a.sampleRate) / float64(size)
+	radius := int(envelopeWidth / binWidth / 2)
+	magnitudes := make([]float64, size/2)
+	for i := range magnitudes {
+		magnitudes[i] = cmplx.Abs(values[i])
+	}
+
+	envelope := make([]float64, len(magnitudes))
+	for i := range envelope {
+		count := 0
+		for j := i - radius; j <= i+radius; j++ {
+			if j >= 0 && j < len(magnitudes) {
+				envelope[i] += magnitudes[j]
+				count++
+			}
+		}
+		envelope[i] /= float64(count)
+	}
+
+	f1 := peak(envelope, binWidth, f1Min, f1Max)
+	f2 := peak(envelope, binWidth, math.Max(f2Min, f1+300), f2Max)
+
+	return loudness, f1, f2
+
+}
+
+// Add samples, from -1 to 1, and return the latest mouth shapes if any were analyzed
+func (a *analyzer) feed(samples []float64, threshold float64, smoothing float64) (obj.BlendShapes, bool) {
+
+	a.pending = append(a.pending, samples...)
+
+	size := len(a.window)
+	analyzed := false
+	for len(a.pending) >= size {
+
+		loudness, f1, f2 := a.formants(a.pending[:size])
+
+		// Windows overlap by half, so nothing falls between them
+		a.pending = a.pending[size/2:]
+		analyzed = true
+
+		// How open the mouth is comes from how loud the voice is
+		open := obj.Clamp((loudness - threshold) / loudnessRange)
+
+		// Which vowel it sounds like comes from how close the formants are to each vowel's
+		scores := make(map[string]float64)
+		var total float64
+		for _, v := range vowels {
+			d1 := math.Log(f1 / v.f1)
+			d2 := math.Log(f2 / v.f2)
+			score := math.Exp(-(d1*d1 + d2*d2) / (vowelSpread * vowelSpread))
+			scores[v.blendShape] = score
+			total += score
+		}
+
+		for _, v := range vowels {
+
+			weight := 0.0
+			if total > 0 && open > 0 {
+				weight = open * scores[v.blendShape] / total
+			}
+
+			// Odd formants may give NaN, which would stick around through smoothing and can't be sent as JSON
+			if math.IsNaN(weight) {
+				weight = 0
+			}
+
+			a.weights[v.blendShape] = obj.Clamp(a.weights[v.blendShape]*smoothing + weight*(1-smoothing))
+
+		}
+
+	}
+
+	if !analyzed {
+		return nil, false
+	}
+
+	blendShapes := make(obj.BlendShapes)
+	for name, weight := range a.weights {
+		blendShapes[name] = obj.BlendShape(weight)
+	}
+
+	return blendShapes, true
+
+}
@@ -0,0 +1,65 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lipsync
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFeedWeights(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		sampleRate int
+		frequency  float64 // Of a loud sine wave, or silence if zero
+	}{
+		{name: "silence", sampleRate: 48000},
+		{name: "low voice", sampleRate: 48000, frequency: 700},
+		{name: "high voice", sampleRate: 44100, frequency: 2200},
+		{name: "lowest sample rate", sampleRate: minSampleRate, frequency: 500},
+		{name: "above every formant range", sampleRate: minSampleRate, frequency: 3900},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			samples := make([]float64, test.sampleRate/2)
+			for i := range samples {
+				samples[i] = 0.8 * math.Sin(2*math.Pi*test.frequency*float64(i)/float64(test.sampleRate))
+			}
+
+			a := newAnalyzer(test.sampleRate)
+			blendShapes, ok := a.feed(samples, -60, 0.5)
+			if !ok {
+				t.Fatal("nothing was analyzed")
+			}
+
+			for name, weight := range blendShapes {
+				if math.IsNaN(float64(weight)) || weight < 0 || weight > 1 {
+					t.Errorf("%s = %v, want from 0 to 1", name, weight)
+				}
+				if test.frequency == 0 && weight != 0 {
+					t.Errorf("%s = %v for silence, want 0", name, weight)
+				}
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,256 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lipsync
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/helper"
+	"github.com/thatpix3l/fntwo/pkg/obj"
+	"github.com/thatpix3l/fntwo/pkg/receivers"
+)
+
+const (
+	defaultSampleRate = 48000 // Sample rate of browser audio, if not given
+	minSampleRate     = 8000  // Lowest sample rate that still covers every formant range
+)
+
+// Drives the mouth from voice audio
+type Receiver struct {
+	*receivers.Base
+	stateMutex sync.Mutex                   // Guards everything below
+	running    bool                         // If WebSocket connections are accepted
+	conns      map[*websocket.Conn]struct{} // Every connected browser
+}
+
+func init() {
+	receivers.Register("LipSync", New)
+}
+
+// Analyze samples and write the resulting mouth shapes
+func (l *Receiver) process(a *analyzer, samples []float64) {
+
+	appConfig := l.AppConfig
+	if blendShapes, ok := a.feed(samples, appConfig.LipSyncThreshold, appConfig.LipSyncSmoothing); ok {
+		l.VRM().WriteBlendShapes(blendShapes)
+	}
+
+}
+
+// Close the mouth, e.g. once audio stops coming in
+func (l *Receiver) closeMouth() {
+
+	blendShapes := make(obj.BlendShapes)
+	for _, v := range vowels {
+		blendShapes[v.blendShape] = 0
+	}
+
+	l.VRM().WriteBlendShapes(blendShapes)
+
+}
+
+// Receive audio from a single browser through WebSockets.
+// Each binary message is mono 16-bit little-endian PCM, with the sample rate given by the "rate" query parameter.
+func (l *Receiver) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+
+	l.stateMutex.Lock()
+	if !l.running {
+		l.stateMutex.Unlock()
+		http.Error(w, "LipSync receiver is not running", http.StatusServiceUnavailable)
+		return
+	}
+	l.stateMutex.Unlock()
+
+	sampleRate := defaultSampleRate
+	if rate := r.URL.Query().Get("rate"); rate != "" {
+
+		parsed, err := strconv.Atoi(rate)
+		if err != nil || parsed < minSampleRate {
+			http.Error(w, fmt.Sprintf("invalid sample rate, must be at least %d Hz", minSampleRate), http.StatusBadRequest)
+			return
+		}
+		sampleRate = parsed
+
+	}
+
+	ws, err := helper.WebSocketUpgrade(w, r)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// Keep track of connection, so it can be closed when stopping.
+	// Stopping may have happened while upgrading, so check again along with adding it.
+	l.stateMutex.Lock()
+	if !l.running {
+		l.stateMutex.Unlock()
+		ws.Close()
+		return
+	}
+	l.conns[ws] = struct{}{}
+	l.stateMutex.Unlock()
+
+	defer func() {
+		l.stateMutex.Lock()
+		delete(l.conns, ws)
+		l.stateMutex.Unlock()
+		ws.Close()
+		l.closeMouth()
+	}()
+
+	log.Printf("Adding new LipSync client, with audio at %d Hz...", sampleRate)
+
+	a := newAnalyzer(sampleRate)
+	for {
+
+		messageType, message, err := ws.ReadMessage()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		// Only audio is sent as binary
+		if messageType != websocket.BinaryMessage {
+			continue
+		}
+
+		samples := make([]float64, len(message)/2)
+		for i := range samples {
+			samples[i] = float64(int16(binary.LittleEndian.Uint16(message[i*2:]))) / 32768
+		}
+
+		l.process(a, samples)
+		l.Received(r.RemoteAddr)
+
+	}
+
+}
+
+// Play a WAV file in real time, until it ends or the receiver stops
+func (l *Receiver) playWAV(ctx context.Context, path string, samples []float64, sampleRate int) {
+
+	log.Printf("Lip syncing to %s, %.1f seconds long", path, float64(len(samples))/float64(sampleRate))
+
+	ticker := time.NewTicker(time.Duration(1e9 / l.AppConfig.ModelUpdateFrequency))
+	defer ticker.Stop()
+
+	a := newAnalyzer(sampleRate)
+	started := time.Now()
+	played := 0
+	for played < len(samples) {
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Catch up to however much audio would have been played by now
+		upTo := int(time.Since(started).Seconds() * float64(sampleRate))
+		if upTo > len(samples) {
+			upTo = len(samples)
+		}
+
+		l.process(a, samples[played:upTo])
+		l.Received("")
+		played = upTo
+
+	}
+
+	l.closeMouth()
+
+}
+
+// Start accepting audio, and read the WAV file if one was given.
+// Returns a function that plays the WAV file, then waits until the context is cancelled.
+func (l *Receiver) listen(ctx context.Context) (func(), error) {
+
+	// Read now, so failures are reported to whoever started the receiver
+	var samples []float64
+	var sampleRate int
+	if l.AppConfig.LipSyncWAV != "" {
+
+		var err error
+		if samples, sampleRate, err = readWAV(l.AppConfig.LipSyncWAV); err != nil {
+			return nil, err
+		}
+
+	} else {
+		log.Println("Listening for LipSync audio")
+	}
+
+	l.stateMutex.Lock()
+	l.running = true
+	l.stateMutex.Unlock()
+
+	return func() {
+
+		defer l.stopListening()
+
+		if samples != nil {
+			l.playWAV(ctx, l.AppConfig.LipSyncWAV, samples, sampleRate)
+		}
+
+		<-ctx.Done()
+
+	}, nil
+
+}
+
+// Stop accepting audio, closing every connected browser
+func (l *Receiver) stopListening() {
+
+	l.stateMutex.Lock()
+	defer l.stateMutex.Unlock()
+
+	l.running = false
+
+	// WebSocket connections are hijacked, so they have to be closed by hand
+	for ws := range l.conns {
+		ws.Close()
+	}
+
+}
+
+// Start receiving in background
+func (l *Receiver) Start(ctx context.Context) error {
+	return l.Run(ctx, l.listen)
+}
+
+// Create a new receiver.
+// Drives the mouth from voice, either from browsers sending microphone audio through WebSockets or from a WAV file.
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
+
+	l := &Receiver{
+		Base:  receivers.NewBase(env.AppConfig, instance),
+		conns: make(map[*websocket.Conn]struct{}),
+	}
+	l.Mount("/live/write/audio", http.HandlerFunc(l.handleWebSocket))
+
+	return l, nil
+
+}
@@ -0,0 +1,216 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lipsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// Format of the audio in a WAV file
+type wavFormat struct {
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// Decode a single sample into a value from -1 to 1
+func decodeSample(data []byte, format wavFormat) float64 {
+
+	if format.AudioFormat == wavFormatFloat {
+		switch format.BitsPerSample {
+		case 32:
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+		case 64:
+			return math.Float64frombits(binary.LittleEndian.Uint64(data))
+		}
+		return 0
+	}
+
+	switch format.BitsPerSample {
+	case 8:
+		return (float64(data[0]) - 128) / 128
+	case 16:
+		return float64(int16(binary.LittleEndian.Uint16(data))) / 32768
+	case 24:
+		value := int32(data[0]) | int32(data[1])<<8 | int32(int8(data[2]))<<16
+		return float64(value) / 8388608
+	case 32:
+		return float64(int32(binary.LittleEndian.Uint32(data))) / 2147483648
+	}
+
+	return 0
+
+}
+
+// Check that samples of a format can be decoded, and that each frame is exactly one sample per channel
+func (f wavFormat) validate() error {
+
+	if f.Channels == 0 || f.SampleRate == 0 {
+		return errors.New("invalid WAV format chunk")
+	}
+
+	if f.SampleRate < minSampleRate {
+		return fmt.Errorf("WAV sample rate of %d Hz is too low, must be at least %d Hz", f.SampleRate, minSampleRate)
+	}
+
+	switch {
+	case f.AudioFormat == wavFormatPCM && (f.BitsPerSample == 8 || f.BitsPerSample == 16 || f.BitsPerSample == 24 || f.BitsPerSample == 32):
+	case f.AudioFormat == wavFormatFloat && (f.BitsPerSample == 32 || f.BitsPerSample == 64):
+	default:
+		return fmt.Errorf("unsupported WAV sample size of %d bits", f.BitsPerSample)
+	}
+
+	if int(f.BlockAlign) != int(f.Channels)*int(f.BitsPerSample)/8 {
+		return errors.New("WAV block align does not match its channels and sample size")
+	}
+
+	return nil
+
+}
+
+// Read a WAV file, mixing all of its channels down to one.
+// Returns samples from -1 to 1, along with their sample rate.
+func readWAV(path string) ([]float64, int, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	return decodeWAV(file)
+
+}
+
+// Decode WAV data, mixing all of its channels down to one.
+// Chunk sizes are never trusted for allocating, so a broken header can't claim more than what's actually there.
+func decodeWAV(file io.ReadSeeker) ([]float64, int, error) {
+
+	var riff [12]byte
+	if _, err := io.ReadFull(file, riff[:]); err != nil {
+		return nil, 0, err
+	}
+
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, 0, errors.New("not a WAV file")
+	}
+
+	var format *wavFormat
+	for {
+
+		// Every chunk starts with its ID and size
+		var header [8]byte
+		if _, err := io.ReadFull(file, header[:]); err != nil {
+			return nil, 0, errors.New("WAV file has no audio data")
+		}
+		id := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+
+		switch id {
+		case "fmt ":
+
+			chunk, err := io.ReadAll(io.LimitReader(file, size))
+			if err != nil {
+				return nil, 0, err
+			}
+
+			if len(chunk) < 16 {
+				return nil, 0, errors.New("invalid WAV format chunk")
+			}
+
+			format = &wavFormat{
+				AudioFormat:   binary.LittleEndian.Uint16(chunk[0:2]),
+				Channels:      binary.LittleEndian.Uint16(chunk[2:4]),
+				SampleRate:    binary.LittleEndian.Uint32(chunk[4:8]),
+				ByteRate:      binary.LittleEndian.Uint32(chunk[8:12]),
+				BlockAlign:    binary.LittleEndian.Uint16(chunk[12:14]),
+				BitsPerSample: binary.LittleEndian.Uint16(chunk[14:16]),
+			}
+
+			// The actual format of extensible files is at the start of their sub-format
+			if format.AudioFormat == wavFormatExtensible && len(chunk) >= 26 {
+				format.AudioFormat = binary.LittleEndian.Uint16(chunk[24:26])
+			}
+
+			if format.AudioFormat != wavFormatPCM && format.AudioFormat != wavFormatFloat {
+				return nil, 0, errors.New("unsupported WAV audio format")
+			}
+
+			if err := format.validate(); err != nil {
+				return nil, 0, err
+			}
+
+		case "data":
+
+			if format == nil {
+				return nil, 0, errors.New("WAV audio data comes before its format")
+			}
+
+			// Files cut short are still usable up to their last whole frame
+			data, err := io.ReadAll(io.LimitReader(file, size))
+			if err != nil {
+				return nil, 0, err
+			}
+
+			// Average every channel of each frame
+			sampleSize := int(format.BitsPerSample) / 8
+			frameSize := int(format.BlockAlign)
+			samples := make([]float64, len(data)/frameSize)
+			for i := range samples {
+				frame := data[i*frameSize:]
+				for c := 0; c < int(format.Channels); c++ {
+					samples[i] += decodeSample(frame[c*sampleSize:], *format)
+				}
+				samples[i] /= float64(format.Channels)
+			}
+
+			return samples, int(format.SampleRate), nil
+
+		default:
+
+			// Skip anything else, e.g. metadata
+			if _, err := file.Seek(size+size%2, io.SeekCurrent); err != nil {
+				return nil, 0, err
+			}
+
+		}
+
+		// Chunks are padded to an even size
+		if id == "fmt " && size%2 == 1 {
+			if _, err := file.Seek(1, io.SeekCurrent); err != nil {
+				return nil, 0, err
+			}
+		}
+
+	}
+
+}
@@ -0,0 +1,157 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lipsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// Build a WAV file out of a format chunk and data, where dataSize is the size claimed by the data chunk header
+func buildWAV(format wavFormat, data []byte, dataSize uint32) []byte {
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	buf.WriteString("WAVE")
+
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, format)
+
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, dataSize)
+	buf.Write(data)
+
+	return buf.Bytes()
+
+}
+
+func pcmFormat(channels uint16, bits uint16) wavFormat {
+	return wavFormat{
+		AudioFormat:   wavFormatPCM,
+		Channels:      channels,
+		SampleRate:    8000,
+		ByteRate:      8000 * uint32(channels) * uint32(bits) / 8,
+		BlockAlign:    channels * bits / 8,
+		BitsPerSample: bits,
+	}
+}
+
+func TestDecodeWAV(t *testing.T) {
+
+	oddBlockAlign := pcmFormat(1, 16)
+	oddBlockAlign.BlockAlign = 3
+
+	fourBits := pcmFormat(1, 16)
+	fourBits.BitsPerSample = 4
+	fourBits.BlockAlign = 0
+
+	noRate := pcmFormat(1, 16)
+	noRate.SampleRate = 0
+
+	lowRate := pcmFormat(1, 16)
+	lowRate.SampleRate = 4000
+	lowRate.ByteRate = 8000
+
+	tests := []struct {
+		name    string
+		file    []byte
+		samples []float64
+		wantErr bool
+	}{
+		{
+			name:    "16-bit mono",
+			file:    buildWAV(pcmFormat(1, 16), []byte{0x00, 0x40, 0x00, 0xC0}, 4),
+			samples: []float64{0.5, -0.5},
+		},
+		{
+			name:    "8-bit stereo is mixed down",
+			file:    buildWAV(pcmFormat(2, 8), []byte{192, 64, 255, 255}, 4),
+			samples: []float64{0, 127.0 / 128},
+		},
+		{
+			name:    "data cut short keeps whole frames",
+			file:    buildWAV(pcmFormat(1, 16), []byte{0x00, 0x40, 0x00}, 4),
+			samples: []float64{0.5},
+		},
+		{
+			name:    "huge data size is bounded by the file",
+			file:    buildWAV(pcmFormat(1, 16), []byte{0x00, 0x40}, 0xFFFFFFFF),
+			samples: []float64{0.5},
+		},
+		{
+			name:    "sample size under 8 bits",
+			file:    buildWAV(fourBits, []byte{0x00, 0x40}, 2),
+			wantErr: true,
+		},
+		{
+			name:    "block align not matching",
+			file:    buildWAV(oddBlockAlign, []byte{0x00, 0x40}, 2),
+			wantErr: true,
+		},
+		{
+			name:    "no sample rate",
+			file:    buildWAV(noRate, []byte{0x00, 0x40}, 2),
+			wantErr: true,
+		},
+		{
+			name:    "sample rate too low for formants",
+			file:    buildWAV(lowRate, []byte{0x00, 0x40}, 2),
+			wantErr: true,
+		},
+		{
+			name:    "not a WAV file",
+			file:    []byte("RIFF\x00\x00\x00\x00AVI "),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			samples, rate, err := decodeWAV(bytes.NewReader(test.file))
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rate != 8000 {
+				t.Errorf("sample rate = %d, want 8000", rate)
+			}
+
+			if len(samples) != len(test.samples) {
+				t.Fatalf("samples = %v, want %v", samples, test.samples)
+			}
+			for i := range samples {
+				if samples[i] != test.samples[i] {
+					t.Errorf("samples = %v, want %v", samples, test.samples)
+					break
+				}
+			}
+
+		})
+	}
+
+}
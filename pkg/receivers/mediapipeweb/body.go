@@ -0,0 +1,193 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package mediapipeweb
+
+import "github.com/thatpix3l/fntwo/pkg/obj"
+
+const (
+	poseLandmarkCount = 33  // Number of landmarks in Mediapipe's Pose
+	minVisibility     = 0.5 // Landmarks less likely to be visible than this are ignored
+)
+
+// Single Pose landmark, which also has how likely it is to be visible
+type poseLandmark struct {
+	obj.Position
+	Visibility float64 `json:"visibility"`
+}
+
+// Landmarks and bones of a single arm
+type arm struct {
+	side     string // Side of the body, either "Left" or "Right"
+	shoulder int
+	elbow    int
+	wrist    int
+	rest     obj.Position // Direction the arm points towards in a T-pose
+	upperArm string       // Name of upper arm bone
+	lowerArm string       // Name of lower arm bone
+}
+
+// Solved rotations of the upper body
+type body struct {
+	chest     obj.QuaternionRotation            // Rotation of the chest, relative to the world
+	lowerArms map[string]obj.QuaternionRotation // Rotation of each lower arm by side, relative to the world
+	bones     map[string]obj.QuaternionRotation // Rotation of each bone, relative to its parent
+}
+
+var (
+	// Hips and shoulders, where left and right are of the person in the video
+	leftHip       = 23
+	rightHip      = 24
+	leftShoulder  = 11
+	rightShoulder = 12
+
+	// Both arms. Facing the camera, the left arm points towards positive X in a T-pose.
+	arms = []arm{
+		{
+			side:     "Left",
+			shoulder: 11,
+			elbow:    13,
+			wrist:    15,
+			rest:     obj.Position{X: 1},
+			upperArm: "LeftUpperArm",
+			lowerArm: "LeftLowerArm",
+		},
+		{
+			side:     "Right",
+			shoulder: 12,
+			elbow:    14,
+			wrist:    16,
+			rest:     obj.Position{X: -1},
+			upperArm: "RightUpperArm",
+			lowerArm: "RightLowerArm",
+		},
+	}
+)
+
+// Rotation that turns the X axis towards "right" and the Y axis as close as possible towards "up"
+func lookRotation(right obj.Position, up obj.Position) obj.QuaternionRotation {
+
+	right = right.Normalize()
+	forward := right.Cross(up).Normalize()
+	up = forward.Cross(right).Normalize()
+
+	return obj.QuaternionFromBasis(right, up, forward)
+
+}
+
+// Convert Pose landmarks into the same coordinates used for face mesh landmarks.
+// World landmarks are preferred, as they aren't distorted by the shape of the video.
+func poseLandmarks(frame mediapipeFrame) ([]poseLandmark, bool) {
+
+	if len(frame.PoseWorldLandmarks) >= poseLandmarkCount {
+
+		landmarks := make([]poseLandmark, len(frame.PoseWorldLandmarks))
+		for i, landmark := range frame.PoseWorldLandmarks {
+			landmarks[i] = poseLandmark{
+				Position: obj.Position{
+					X: landmark.X,
+					Y: -landmark.Y,
+					Z: -landmark.Z,
+				},
+				Visibility: landmark.Visibility,
+			}
+		}
+
+		return landmarks, true
+
+	}
+
+	if len(frame.PoseLandmarks) >= poseLandmarkCount {
+
+		landmarks := make([]poseLandmark, len(frame.PoseLandmarks))
+		for i, landmark := range frame.PoseLandmarks {
+			landmarks[i] = poseLandmark{
+				Position:   normalizePosition(landmark.Position, mpWorldOrigin, frame.Video),
+				Visibility: landmark.Visibility,
+			}
+		}
+
+		return landmarks, true
+
+	}
+
+	return nil, false
+
+}
+
+// Solve rotations of the hips, spine, chest and arms from Pose landmarks
+func solveBody(frame mediapipeFrame) (body, bool) {
+
+	landmarks, ok := poseLandmarks(frame)
+	if !ok {
+		return body{}, false
+	}
+
+	// Can't do anything without a torso
+	for _, i := range []int{leftHip, rightHip, leftShoulder, rightShoulder} {
+		if landmarks[i].Visibility < minVisibility {
+			return body{}, false
+		}
+	}
+
+	hipsCenter := centroid(landmarks[leftHip].Position, landmarks[rightHip].Position)
+	shouldersCenter := centroid(landmarks[leftShoulder].Position, landmarks[rightShoulder].Position)
+
+	// Hips only turn around, and the rest of the torso leans from them
+	hips := lookRotation(directionVector(landmarks[rightHip].Position, landmarks[leftHip].Position), obj.Position{Y: 1})
+	chest := lookRotation(directionVector(landmarks[rightShoulder].Position, landmarks[leftShoulder].Position), directionVector(hipsCenter, shouldersCenter))
+
+	// Spread the lean evenly between the spine and chest
+	spine := identity.Slerp(hips.Conjugate().Multiply(chest), 0.5)
+
+	solved := body{
+		chest:     chest,
+		lowerArms: make(map[string]obj.QuaternionRotation),
+		bones: map[string]obj.QuaternionRotation{
+			"Hips":  hips,
+			"Spine": spine,
+			"Chest": spine,
+		},
+	}
+
+	for _, a := range arms {
+
+		// Skip arms that are out of view
+		if landmarks[a.elbow].Visibility < minVisibility || landmarks[a.wrist].Visibility < minVisibility {
+			continue
+		}
+
+		// Turn the T-pose direction of each bone towards where the landmarks say it points
+		upperArm := obj.QuaternionFromTo(chest.Rotate(a.rest), directionVector(landmarks[a.shoulder].Position, landmarks[a.elbow].Position)).Multiply(chest)
+		lowerArm := obj.QuaternionFromTo(upperArm.Rotate(a.rest), directionVector(landmarks[a.elbow].Position, landmarks[a.wrist].Position)).Multiply(upperArm)
+
+		solved.bones[a.upperArm] = chest.Conjugate().Multiply(upperArm)
+		solved.bones[a.lowerArm] = upperArm.Conjugate().Multiply(lowerArm)
+		solved.lowerArms[a.side] = lowerArm
+
+	}
+
+	return solved, true
+
+}
+
+// Write every solved bone of the upper body
+func (m *Receiver) writeBody(solved body) {
+	for name, rotation := range solved.bones {
+		m.VRM().WriteRotation(name, rotation)
+	}
+}
@@ -0,0 +1,224 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package mediapipeweb
+
+import (
+	"math"
+	"strings"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+const (
+	irisLandmarkCount = 478 // Number of landmarks in Mediapipe's face mesh, including irises
+
+	eyeOpenRatio   = 0.28 // Eye aspect ratio of a fully open eye
+	eyeClosedRatio = 0.12 // Eye aspect ratio of a fully closed eye
+
+	mouthOpenRatio    = 0.5  // Ratio of mouth height to width when fully open
+	mouthNeutralWidth = 0.38 // Ratio of mouth width to face width when relaxed
+	mouthWideRange    = 0.1  // How much wider than relaxed the mouth is when fully wide
+	mouthNarrowRange  = 0.06 // How much narrower than relaxed the mouth is when fully puckered
+
+	browNeutralRatio = 0.06 // Ratio of brow to eyelid distance to face height when relaxed
+	browRaiseRange   = 0.04 // How much further the brows are when fully raised
+
+	gazeRange = 0.2 // How far from the center of the eye the iris is when looking all the way to one side
+)
+
+// Landmarks around a single eye, in the order used for the eye aspect ratio:
+// outer corner, two points on the upper lid, inner corner, two points on the lower lid
+type eyeLandmarks [6]int
+
+// Landmarks around the iris of a single eye
+type irisLandmarks struct {
+	center int
+	inner  int // Inner corner of the eye
+	outer  int // Outer corner of the eye
+	upper  int // Middle of upper lid
+	lower  int // Middle of lower lid
+}
+
+var (
+	leftEye  = eyeLandmarks{263, 387, 385, 362, 380, 373}
+	rightEye = eyeLandmarks{33, 160, 158, 133, 153, 144}
+
+	leftIris  = irisLandmarks{center: 473, inner: 362, outer: 263, upper: 386, lower: 374}
+	rightIris = irisLandmarks{center: 468, inner: 133, outer: 33, upper: 159, lower: 145}
+
+	// Lips and mouth corners
+	upperLip         = 13
+	lowerLip         = 14
+	innerMouthCorner = [2]int{78, 308}
+	outerMouthCorner = [2]int{61, 291}
+
+	// Sides and top and bottom of the face
+	faceSides  = [2]int{234, 454}
+	faceTop    = 10
+	faceBottom = 152
+
+	// Inner brows and the upper eyelids below them
+	innerBrows = [2]int{107, 336}
+	upperLids  = [2]int{159, 386}
+)
+
+// Distance between two landmarks
+func distance(landmarks []obj.Position, from int, to int) float64 {
+	return directionVector(landmarks[from], landmarks[to]).Length()
+}
+
+// Eye aspect ratio, which is the height of the eye compared to its width
+func eyeAspectRatio(landmarks []obj.Position, eye eyeLandmarks) float64 {
+
+	width := distance(landmarks, eye[0], eye[3])
+	if width == 0 {
+		return 0
+	}
+
+	return (distance(landmarks, eye[1], eye[5]) + distance(landmarks, eye[2], eye[4])) / (2 * width)
+
+}
+
+// How closed an eye is, from 0 to 1
+func blink(landmarks []obj.Position, eye eyeLandmarks) float64 {
+	return obj.Clamp((eyeOpenRatio - eyeAspectRatio(landmarks, eye)) / (eyeOpenRatio - eyeClosedRatio))
+}
+
+// Where the iris is looking, from -1 to 1, relative to the center of the eye.
+// Positive X is towards the outer corner, and positive Y is up.
+func gaze(landmarks []obj.Position, iris irisLandmarks) (float64, float64) {
+
+	inner := landmarks[iris.inner]
+	outer := landmarks[iris.outer]
+	center := landmarks[iris.center]
+
+	// Project iris onto the line between the corners, where 0 is the middle of the eye
+	across := directionVector(inner, outer)
+	width := across.Length()
+	if width == 0 {
+		return 0, 0
+	}
+	x := directionVector(centroid(inner, outer), center).Dot(across) / (width * width)
+
+	// Same for the line between the lids
+	upDown := directionVector(landmarks[iris.lower], landmarks[iris.upper])
+	height := upDown.Length()
+	if height == 0 {
+		return x / gazeRange, 0
+	}
+	y := directionVector(centroid(landmarks[iris.lower], landmarks[iris.upper]), center).Dot(upDown) / (height * height)
+
+	return x / gazeRange, y / gazeRange
+
+}
+
+// Roughly match the shape of the mouth to each vowel, from how open, wide and puckered it is
+func writeVowels(blendShapes obj.BlendShapes, open float64, wide float64, narrow float64) {
+	blendShapes[obj.BlendShapeA] = obj.BlendShape(open * (1 - wide) * (1 - narrow))
+	blendShapes[obj.BlendShapeI] = obj.BlendShape((1 - open) * wide)
+	blendShapes[obj.BlendShapeU] = obj.BlendShape((1 - open) * narrow)
+	blendShapes[obj.BlendShapeE] = obj.BlendShape(open * wide)
+	blendShapes[obj.BlendShapeO] = obj.BlendShape(open * narrow)
+}
+
+// Derive VRM preset blend shapes from normalized face mesh landmarks
+func solveExpressions(landmarks []obj.Position) obj.BlendShapes {
+
+	blendShapes := obj.BlendShapes{
+		obj.BlendShapeBlinkL: obj.BlendShape(blink(landmarks, leftEye)),
+		obj.BlendShapeBlinkR: obj.BlendShape(blink(landmarks, rightEye)),
+	}
+
+	// How open, wide and puckered the mouth is
+	mouthWidth := distance(landmarks, innerMouthCorner[0], innerMouthCorner[1])
+	faceWidth := distance(landmarks, faceSides[0], faceSides[1])
+	faceHeight := distance(landmarks, faceTop, faceBottom)
+	if mouthWidth == 0 || faceWidth == 0 || faceHeight == 0 {
+		return blendShapes
+	}
+
+	open := obj.Clamp(distance(landmarks, upperLip, lowerLip) / mouthWidth / mouthOpenRatio)
+	width := distance(landmarks, outerMouthCorner[0], outerMouthCorner[1]) / faceWidth
+	wide := obj.Clamp((width - mouthNeutralWidth) / mouthWideRange)
+	narrow := obj.Clamp((mouthNeutralWidth - width) / mouthNarrowRange)
+	writeVowels(blendShapes, open, wide, narrow)
+
+	// How far the inner brows are raised above the eyelids
+	browHeight := (distance(landmarks, innerBrows[0], upperLids[0]) + distance(landmarks, innerBrows[1], upperLids[1])) / 2 / faceHeight
+	blendShapes[obj.BlendShapeBrowInnerUp] = obj.BlendShape(obj.Clamp((browHeight - browNeutralRatio) / browRaiseRange))
+
+	// Only newer face meshes include irises
+	if len(landmarks) < irisLandmarkCount {
+		return blendShapes
+	}
+
+	// Both eyes look the same way, so average them. Outer corners are on opposite sides, so flip the right eye.
+	// Looking left moves the left iris towards its outer corner.
+	leftX, leftY := gaze(landmarks, leftIris)
+	rightX, rightY := gaze(landmarks, rightIris)
+	lookX := (leftX - rightX) / 2
+	lookY := (leftY + rightY) / 2
+
+	blendShapes[obj.BlendShapeLookLeft] = obj.BlendShape(obj.Clamp(lookX))
+	blendShapes[obj.BlendShapeLookRight] = obj.BlendShape(obj.Clamp(-lookX))
+	blendShapes[obj.BlendShapeLookUp] = obj.BlendShape(obj.Clamp(lookY))
+	blendShapes[obj.BlendShapeLookDown] = obj.BlendShape(obj.Clamp(-lookY))
+
+	return blendShapes
+
+}
+
+// Convert FaceLandmarker blend shape scores into blend shapes named like the other receivers,
+// along with the VRM presets derived from them
+func convertBlendShapes(categories []blendShapeCategory) obj.BlendShapes {
+
+	// Scores by their ARKit name, e.g. "eyeBlinkLeft"
+	scores := make(map[string]float64)
+	for _, category := range categories {
+
+		// Skip FaceLandmarker-specific blend shapes, like "_neutral"
+		if category.CategoryName == "" || strings.HasPrefix(category.CategoryName, "_") {
+			continue
+		}
+
+		scores[category.CategoryName] = obj.Clamp(category.Score)
+
+	}
+
+	blendShapes := make(obj.BlendShapes)
+	for name, score := range scores {
+		blendShapes[obj.ARKitBlendShapeName(name)] = obj.BlendShape(score)
+	}
+
+	blendShapes[obj.BlendShapeBlinkL] = obj.BlendShape(scores["eyeBlinkLeft"])
+	blendShapes[obj.BlendShapeBlinkR] = obj.BlendShape(scores["eyeBlinkRight"])
+
+	open := scores["jawOpen"]
+	wide := math.Max(scores["mouthSmileLeft"]+scores["mouthSmileRight"], scores["mouthStretchLeft"]+scores["mouthStretchRight"]) / 2
+	narrow := math.Max(scores["mouthPucker"], scores["mouthFunnel"])
+	writeVowels(blendShapes, open, wide, narrow)
+
+	// Looking left turns the left eye outwards and the right eye inwards
+	blendShapes[obj.BlendShapeLookLeft] = obj.BlendShape((scores["eyeLookOutLeft"] + scores["eyeLookInRight"]) / 2)
+	blendShapes[obj.BlendShapeLookRight] = obj.BlendShape((scores["eyeLookInLeft"] + scores["eyeLookOutRight"]) / 2)
+	blendShapes[obj.BlendShapeLookUp] = obj.BlendShape((scores["eyeLookUpLeft"] + scores["eyeLookUpRight"]) / 2)
+	blendShapes[obj.BlendShapeLookDown] = obj.BlendShape((scores["eyeLookDownLeft"] + scores["eyeLookDownRight"]) / 2)
+
+	return blendShapes
+
+}
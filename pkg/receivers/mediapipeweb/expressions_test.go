@@ -0,0 +1,100 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package mediapipeweb
+
+import (
+	"testing"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+func TestConvertBlendShapes(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		categories []blendShapeCategory
+		want       obj.BlendShapes // Only these keys are checked
+	}{
+		{
+			name: "named like the other receivers",
+			categories: []blendShapeCategory{
+				{CategoryName: "_neutral", Score: 1},
+				{CategoryName: "eyeBlinkLeft", Score: 0.75},
+				{CategoryName: "browInnerUp", Score: 0.5},
+			},
+			want: obj.BlendShapes{
+				"EyeBlink_L":         0.75,
+				"BrowInnerUp":        0.5,
+				obj.BlendShapeBlinkL: 0.75,
+				obj.BlendShapeBlinkR: 0,
+			},
+		},
+		{
+			name: "open jaw is A",
+			categories: []blendShapeCategory{
+				{CategoryName: "jawOpen", Score: 1},
+			},
+			want: obj.BlendShapes{obj.BlendShapeA: 1, obj.BlendShapeE: 0, obj.BlendShapeO: 0},
+		},
+		{
+			name: "open and puckered is O",
+			categories: []blendShapeCategory{
+				{CategoryName: "jawOpen", Score: 1},
+				{CategoryName: "mouthFunnel", Score: 1},
+			},
+			want: obj.BlendShapes{obj.BlendShapeA: 0, obj.BlendShapeO: 1, obj.BlendShapeU: 0},
+		},
+		{
+			name: "closed and smiling is I",
+			categories: []blendShapeCategory{
+				{CategoryName: "mouthSmileLeft", Score: 1},
+				{CategoryName: "mouthSmileRight", Score: 1},
+			},
+			want: obj.BlendShapes{obj.BlendShapeI: 1, obj.BlendShapeA: 0},
+		},
+		{
+			name: "looking left",
+			categories: []blendShapeCategory{
+				{CategoryName: "eyeLookOutLeft", Score: 0.5},
+				{CategoryName: "eyeLookInRight", Score: 0.5},
+			},
+			want: obj.BlendShapes{obj.BlendShapeLookLeft: 0.5, obj.BlendShapeLookRight: 0},
+		},
+		{
+			name: "scores are clamped",
+			categories: []blendShapeCategory{
+				{CategoryName: "eyeBlinkRight", Score: 1.5},
+			},
+			want: obj.BlendShapes{"EyeBlink_R": 1, obj.BlendShapeBlinkR: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			blendShapes := convertBlendShapes(test.categories)
+			for key, want := range test.want {
+				if got, ok := blendShapes[key]; !ok || got != want {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+
+		})
+	}
+
+}
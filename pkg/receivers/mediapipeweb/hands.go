@@ -0,0 +1,161 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package mediapipeweb
+
+import (
+	"math"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+const (
+	handLandmarkCount = 21 // Number of landmarks in Mediapipe's Hands
+)
+
+// Landmarks of a single finger, from where it starts on the palm to its tip
+type finger struct {
+	name      string // Name of finger, based off of Unity's HumanBodyBones
+	landmarks [5]int
+	thumb     bool // Thumbs point differently from the other fingers in a T-pose
+}
+
+// Rest directions and landmarks of a single hand
+type hand struct {
+	side       string       // Side of the body, either "Left" or "Right"
+	rest       obj.Position // Direction the fingers point towards in a T-pose
+	restThumb  obj.Position // Direction the thumb points towards in a T-pose
+	restAcross obj.Position // Direction from the little finger to the index finger in a T-pose
+}
+
+var (
+	// Landmarks of the wrist and the base of the index, middle and little fingers
+	wrist      = 0
+	indexBase  = 5
+	middleBase = 9
+	littleBase = 17
+
+	fingers = []finger{
+		{name: "Thumb", landmarks: [5]int{0, 1, 2, 3, 4}, thumb: true},
+		{name: "Index", landmarks: [5]int{0, 5, 6, 7, 8}},
+		{name: "Middle", landmarks: [5]int{0, 9, 10, 11, 12}},
+		{name: "Ring", landmarks: [5]int{0, 13, 14, 15, 16}},
+		{name: "Little", landmarks: [5]int{0, 17, 18, 19, 20}},
+	}
+
+	// Bones of each finger, from the palm outwards
+	fingerBones = [3]string{"Proximal", "Intermediate", "Distal"}
+
+	// Facing the camera in a T-pose, palms face down and thumbs point halfway between forward and outward
+	leftHand = hand{
+		side:       "Left",
+		rest:       obj.Position{X: 1},
+		restThumb:  obj.Position{X: math.Sqrt2 / 2, Z: math.Sqrt2 / 2},
+		restAcross: obj.Position{Z: 1},
+	}
+	rightHand = hand{
+		side:       "Right",
+		rest:       obj.Position{X: -1},
+		restThumb:  obj.Position{X: -math.Sqrt2 / 2, Z: math.Sqrt2 / 2},
+		restAcross: obj.Position{Z: 1},
+	}
+)
+
+// Rotation that turns the X axis towards "along", and the Z axis as close as possible towards "across"
+func frameRotation(along obj.Position, across obj.Position) obj.QuaternionRotation {
+
+	along = along.Normalize()
+	across = across.Sub(along.Scale(across.Dot(along))).Normalize()
+
+	return obj.QuaternionFromBasis(along, across.Cross(along), across)
+
+}
+
+// Convert hand landmarks into the same coordinates used for face mesh landmarks.
+// World landmarks are preferred, as they aren't distorted by the shape of the video.
+func handLandmarks(landmarks []obj.Position, worldLandmarks []obj.Position, video videoMetadata) ([]obj.Position, bool) {
+
+	if len(worldLandmarks) >= handLandmarkCount {
+
+		converted := make([]obj.Position, len(worldLandmarks))
+		for i, landmark := range worldLandmarks {
+			converted[i] = obj.Position{
+				X: landmark.X,
+				Y: -landmark.Y,
+				Z: -landmark.Z,
+			}
+		}
+
+		return converted, true
+
+	}
+
+	if len(landmarks) >= handLandmarkCount {
+
+		converted := make([]obj.Position, len(landmarks))
+		for i, landmark := range landmarks {
+			converted[i] = normalizePosition(landmark, mpWorldOrigin, video)
+		}
+
+		return converted, true
+
+	}
+
+	return nil, false
+
+}
+
+// Solve rotations of the hand and every finger bone from hand landmarks.
+// The parent is the rotation of the lower arm, which is identity if unknown.
+func solveHand(h hand, landmarks []obj.Position, parent obj.QuaternionRotation) map[string]obj.QuaternionRotation {
+
+	bones := make(map[string]obj.QuaternionRotation)
+
+	// Rotation of the whole hand, from how the palm is turned
+	palm := frameRotation(
+		directionVector(landmarks[wrist], landmarks[middleBase]),
+		directionVector(landmarks[littleBase], landmarks[indexBase]),
+	)
+	handRotation := palm.Multiply(frameRotation(h.rest, h.restAcross).Conjugate())
+	bones[h.side+"Hand"] = parent.Conjugate().Multiply(handRotation)
+
+	for _, f := range fingers {
+
+		rest := h.rest
+		if f.thumb {
+			rest = h.restThumb
+		}
+
+		// Turn the T-pose direction of each bone towards where the landmarks say it points, starting from the palm
+		boneParent := handRotation
+		for i, boneName := range fingerBones {
+
+			bone := obj.QuaternionFromTo(
+				boneParent.Rotate(rest),
+				directionVector(landmarks[f.landmarks[i+1]], landmarks[f.landmarks[i+2]]),
+			).Multiply(boneParent)
+
+			bones[h.side+f.name+boneName] = boneParent.Conjugate().Multiply(bone)
+			boneParent = bone
+
+		}
+
+	}
+
+	return bones
+
+}
@@ -0,0 +1,130 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package mediapipeweb
+
+import "github.com/thatpix3l/fntwo/pkg/obj"
+
+const (
+	faceMeshLandmarkCount = 468 // Number of landmarks in Mediapipe's face mesh, not including irises
+	headSmoothing         = 0.5 // How much of the previous head rotation to keep each frame, from 0 to 1
+)
+
+var (
+	// Landmarks along the bottom of the chin and top of the forehead
+	chinLandmarks     = []int{152, 148, 377}
+	foreheadLandmarks = []int{10, 109, 338}
+
+	// How much of the full head rotation each bone gets, from the head down
+	headDistribution = map[string]float64{
+		"Head":  0.6,
+		"Neck":  0.3,
+		"Spine": 0.1,
+	}
+
+	// Same as above, but for when the spine is already being rotated by body tracking
+	neckDistribution = map[string]float64{
+		"Head": 0.6,
+		"Neck": 0.4,
+	}
+)
+
+// Retrieve landmarks by their indices
+func pickLandmarks(landmarks []obj.Position, indices []int) []obj.Position {
+
+	var picked []obj.Position
+	for _, i := range indices {
+		picked = append(picked, landmarks[i])
+	}
+
+	return picked
+
+}
+
+// Solve the rotation of the head from normalized face mesh landmarks.
+// The direction the face points towards is the average normal of every face mesh triangle,
+// and the direction of up is from the chin to the forehead.
+func solveHead(landmarks []obj.Position) obj.QuaternionRotation {
+
+	// Add together the normal of every triangle, where larger triangles have more influence
+	var forward obj.Position
+	for _, triangle := range faceMeshTriangleIndices {
+
+		a := landmarks[triangle[0]]
+		b := landmarks[triangle[1]]
+		c := landmarks[triangle[2]]
+
+		forward = forward.Add(directionVector(a, b).Cross(directionVector(a, c)))
+
+	}
+	forward = forward.Normalize()
+
+	// A face that can be seen by the camera always points towards it
+	if forward.Z < 0 {
+		forward = forward.Scale(-1)
+	}
+
+	up := directionVector(
+		centroid(pickLandmarks(landmarks, chinLandmarks)...),
+		centroid(pickLandmarks(landmarks, foreheadLandmarks)...),
+	)
+
+	// Make every axis perpendicular to each other
+	right := up.Cross(forward).Normalize()
+	up = forward.Cross(right).Normalize()
+
+	return obj.QuaternionFromBasis(right, up, forward)
+
+}
+
+// Extract the rotation of the head from FaceLandmarker's 4x4 column-major facial transformation matrix.
+// The matrix uses the same coordinates as normalized landmarks, so no conversion is needed.
+func matrixRotation(matrix []float64) obj.QuaternionRotation {
+
+	// Each of the first three columns is a rotated axis, which may also be scaled
+	column := func(i int) obj.Position {
+		return obj.Position{
+			X: matrix[i*4],
+			Y: matrix[i*4+1],
+			Z: matrix[i*4+2],
+		}.Normalize()
+	}
+
+	return obj.QuaternionFromBasis(column(0), column(1), column(2))
+
+}
+
+// Smooth and distribute a head rotation between the head, neck and spine bones.
+// The parent is the rotation of whatever the neck is attached to, which is identity if unknown.
+// If the body is being tracked, the spine is left to it, even when the parent couldn't be solved.
+func (m *Receiver) writeHead(c *client, head obj.QuaternionRotation, parent obj.QuaternionRotation, bodyTracked bool) {
+
+	head = c.lastHead.Slerp(head, 1-headSmoothing)
+	c.lastHead = head
+
+	// With a known parent or a tracked body, only the head and neck are left to rotate
+	distribution := headDistribution
+	if parent != identity || bodyTracked {
+		distribution = neckDistribution
+	}
+
+	local := parent.Conjugate().Multiply(head)
+	for name, amount := range distribution {
+		m.VRM().WriteRotation(name, identity.Slerp(local, amount))
+	}
+
+}
@@ -18,11 +18,14 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package mediapipeweb
 
 import (
+	"context"
 	"log"
-	"math"
+	"net"
 	"net/http"
+	"sync"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/thatpix3l/fntwo/pkg/config"
 	"github.com/thatpix3l/fntwo/pkg/helper"
 	"github.com/thatpix3l/fntwo/pkg/obj"
@@ -34,42 +37,68 @@ type videoMetadata struct {
 	Height int `json:"height"` // Height of the source video
 }
 
+// Single blend shape score, as output by Mediapipe's FaceLandmarker
+type blendShapeCategory struct {
+	CategoryName string  `json:"categoryName"` // ARKit-style name in camelCase, e.g. "eyeBlinkLeft"
+	Score        float64 `json:"score"`        // Value from 0 to 1
+}
+
 type mediapipeFacemesh struct {
-	Landmarks []obj.Position `json:"landmarks"` // List of landmark positions
-	Video     videoMetadata  `json:"video"`     // Metadata of source video used in Mediapipe
+	Landmarks            []obj.Position       `json:"landmarks"`                    // List of landmark positions
+	Video                videoMetadata        `json:"video"`                        // Metadata of source video used in Mediapipe
+	BlendShapes          []blendShapeCategory `json:"blendshapes"`                  // Optional blend shape scores from FaceLandmarker
+	TransformationMatrix []float64            `json:"facial_transformation_matrix"` // Optional 4x4 column-major matrix from FaceLandmarker
+}
+
+// Everything sent by the browser for a single frame
+type mediapipeFrame struct {
+	mediapipeFacemesh
+	PoseLandmarks      []poseLandmark `json:"pose_landmarks"`       // Optional list of Pose landmark positions, like face mesh landmarks
+	PoseWorldLandmarks []poseLandmark `json:"pose_world_landmarks"` // Optional list of Pose landmark positions, in meters from the hips
+
+	// Optional lists of Hands landmark positions, where left and right are of the person in the video
+	LeftHandLandmarks       []obj.Position `json:"left_hand_landmarks"`
+	LeftHandWorldLandmarks  []obj.Position `json:"left_hand_world_landmarks"`
+	RightHandLandmarks      []obj.Position `json:"right_hand_landmarks"`
+	RightHandWorldLandmarks []obj.Position `json:"right_hand_world_landmarks"`
 }
 
 var (
-	mpReceiver    *receivers.MotionReceiver
 	mpWorldOrigin = obj.Position{
 		X: 0.5,
 		Y: 0.5,
 		Z: 0,
 	}
 
-	originRayVector = obj.Position{
-		X: 0,
-		Y: 0,
-		Z: 1,
-	}
-
-	originRayVectorMagnitude = math.Pow(
-		math.Pow(float64(originRayVector.X), 2)+
-			math.Pow(float64(originRayVector.Y), 2)+
-			math.Pow(float64(originRayVector.Z), 2),
-		0.2,
-	)
+	identity = obj.QuaternionRotation{W: 1} // Rotation that does nothing
 )
 
-const (
-	coordMultiplier = 2
-)
+// State kept for a single connected browser
+type client struct {
+	lastHead obj.QuaternionRotation // Head rotation of the previous frame, for smoothing
+}
+
+// Receives Mediapipe data solved in the browser, through WebSockets
+type Receiver struct {
+	*receivers.Base
+	running    bool                         // If WebSocket connections are accepted
+	conns      map[*websocket.Conn]struct{} // Every connected browser
+	stateMutex sync.Mutex
+}
+
+func init() {
+	receivers.Register("MediapipeWeb", New)
+}
 
+// Convert a landmark from Mediapipe's normalized image coordinates to the model's coordinates.
+// Mediapipe's X and Y are from 0 to 1 across the width and height of the video, where Y points down.
+// Z is roughly the same scale as X, where it points away from the camera.
+// The result has X pointing right, Y pointing up and Z pointing towards the camera, all in pixels.
 func normalizePosition(position obj.Position, worldOrigin obj.Position, video videoMetadata) obj.Position {
 	return obj.Position{
 		X: (position.X - worldOrigin.X) * float64(video.Width),
-		Y: (position.Y - worldOrigin.Y) * float64(video.Height),
-		Z: (position.Z - worldOrigin.Z) * float64(coordMultiplier),
+		Y: -(position.Y - worldOrigin.Y) * float64(video.Height),
+		Z: -(position.Z - worldOrigin.Z) * float64(video.Width),
 	}
 }
 
@@ -97,45 +126,213 @@ func directionVector(from obj.Position, to obj.Position) obj.Position {
 	return obj.Position{
 		X: to.X - from.X,
 		Y: to.Y - from.Y,
-		Z: to.Z - from.Y,
+		Z: to.Z - from.Z,
+	}
+}
+
+// Process a single frame of Mediapipe data.
+// Whatever FaceLandmarker already solved on the client is used as-is, and the rest is solved from landmarks.
+func (m *Receiver) parseFrame(c *client, frame mediapipeFrame) {
+
+	// Rotation of the upper body, which the head and hands are attached to
+	chest := identity
+	lowerArms := make(map[string]obj.QuaternionRotation)
+	if body, ok := solveBody(frame); ok {
+		m.writeBody(body)
+		chest = body.chest
+		lowerArms = body.lowerArms
 	}
+
+	// Both hands, relative to their lower arm if it's known
+	for h, landmarks := range map[hand][2][]obj.Position{
+		leftHand:  {frame.LeftHandLandmarks, frame.LeftHandWorldLandmarks},
+		rightHand: {frame.RightHandLandmarks, frame.RightHandWorldLandmarks},
+	} {
+
+		converted, ok := handLandmarks(landmarks[0], landmarks[1], frame.Video)
+		if !ok {
+			continue
+		}
+
+		parent, ok := lowerArms[h.side]
+		if !ok {
+			parent = identity
+		}
+
+		for name, rotation := range solveHand(h, converted, parent) {
+			m.VRM().WriteRotation(name, rotation)
+		}
+
+	}
+
+	// Normalize every landmark first
+	var landmarks []obj.Position
+	if len(frame.Landmarks) >= faceMeshLandmarkCount {
+		landmarks = make([]obj.Position, len(frame.Landmarks))
+		for i, landmark := range frame.Landmarks {
+			landmarks[i] = normalizePosition(landmark, mpWorldOrigin, frame.Video)
+		}
+	}
+
+	// With body tracking enabled, the spine belongs to it, even on frames where the body couldn't be solved
+	bodyTracked := len(frame.PoseLandmarks) > 0 || len(frame.PoseWorldLandmarks) > 0
+
+	if len(frame.TransformationMatrix) == 16 {
+		m.writeHead(c, matrixRotation(frame.TransformationMatrix), chest, bodyTracked)
+	} else if landmarks != nil {
+		m.writeHead(c, solveHead(landmarks), chest, bodyTracked)
+	}
+
+	if len(frame.BlendShapes) > 0 {
+		m.VRM().WriteBlendShapes(convertBlendShapes(frame.BlendShapes))
+	} else if landmarks != nil {
+		m.VRM().WriteBlendShapes(solveExpressions(landmarks))
+	}
+
 }
 
-// Start
-func listenMediapipeWeb() {
+// Receive frames of Mediapipe data from a single browser through WebSockets
+func (m *Receiver) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+
+	m.stateMutex.Lock()
+	if !m.running {
+		m.stateMutex.Unlock()
+		http.Error(w, "MediapipeWeb receiver is not running", http.StatusServiceUnavailable)
+		return
+	}
+	m.stateMutex.Unlock()
+
+	ws, err := helper.WebSocketUpgrade(w, r)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// Keep track of connection, so it can be closed when stopping.
+	// Stopping may have happened while upgrading, so check again along with adding it.
+	m.stateMutex.Lock()
+	if !m.running {
+		m.stateMutex.Unlock()
+		ws.Close()
+		return
+	}
+	m.conns[ws] = struct{}{}
+	m.stateMutex.Unlock()
 
-	router := mux.NewRouter()
+	defer func() {
+		m.stateMutex.Lock()
+		delete(m.conns, ws)
+		m.stateMutex.Unlock()
+		ws.Close()
+	}()
 
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	log.Println("Adding new MediapipeWeb client...")
 
-		ws, err := helper.WebSocketUpgrade(w, r)
-		if err != nil {
+	// Smoothing is per browser, so clients don't blend into each other
+	c := &client{
+		lastHead: identity,
+	}
+
+	for {
+
+		// Mediapipe face mesh and pose related data
+		var mpFrame mediapipeFrame
+		if err := ws.ReadJSON(&mpFrame); err != nil {
 			log.Println(err)
 			return
 		}
 
-		for {
+		m.parseFrame(c, mpFrame)
+		m.Received(r.RemoteAddr)
+
+	}
+
+}
+
+// Start accepting WebSocket connections, binding a dedicated server if an address was given.
+// Returns a function that serves until the context is cancelled.
+func (m *Receiver) listen(ctx context.Context) (func(), error) {
+
+	address := m.Listen(m.AppConfig.MPListen)
+
+	// Bind now, so failures are reported to whoever started the receiver
+	var listener net.Listener
+	if address != "" {
+
+		var err error
+		if listener, err = net.Listen("tcp", address.String()); err != nil {
+			return nil, err
+		}
+
+		log.Printf("Listening for MediapipeWeb model transformation data on %s", address)
+
+	}
+
+	m.stateMutex.Lock()
+	m.running = true
+	m.stateMutex.Unlock()
+
+	return func() {
+
+		defer m.stopListening()
+
+		// Only the route on the main API server is used
+		if listener == nil {
+			<-ctx.Done()
+			return
+		}
+
+		router := mux.NewRouter()
+		router.HandleFunc("/", m.handleWebSocket)
+		server := &http.Server{
+			Handler: router,
+		}
 
-			// Mediapipe face mesh related data
-			var mpFaceMesh []obj.Position
-			if err := ws.ReadJSON(&mpFaceMesh); err != nil {
-				log.Println(err)
-				return
-			}
+		// Stop serving once cancelled
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
 
+		// Blocking serve
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			m.Fail(err)
 		}
 
-	})
+	}, nil
 
-	http.ListenAndServe("0.0.0.0:2332", router)
+}
+
+// Stop accepting WebSocket connections, closing every connected browser
+func (m *Receiver) stopListening() {
+
+	m.stateMutex.Lock()
+	defer m.stateMutex.Unlock()
+
+	m.running = false
+
+	// WebSocket connections are hijacked, so closing the server does not close them
+	for ws := range m.conns {
+		ws.Close()
+	}
 
 }
 
-// Create and return reference to a MotionReceiver.
-// Listens for WebSocket connections
-func New(appConfig *config.App) *receivers.MotionReceiver {
+// Start receiving in background
+func (m *Receiver) Start(ctx context.Context) error {
+	return m.Run(ctx, m.listen)
+}
+
+// Create a new receiver.
+// Listens for WebSocket connections, on both its own address and the main API server.
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
+
+	m := &Receiver{
+		Base:  receivers.NewBase(env.AppConfig, instance),
+		conns: make(map[*websocket.Conn]struct{}),
+	}
+	m.Mount("/live/write/mediapipe", http.HandlerFunc(m.handleWebSocket))
 
-	mpReceiver = receivers.New(appConfig, listenMediapipeWeb, func() {})
-	return mpReceiver
+	return m, nil
 
 }
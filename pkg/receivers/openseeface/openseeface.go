@@ -0,0 +1,224 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package openseeface
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log"
+	"net"
+
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/obj"
+	"github.com/thatpix3l/fntwo/pkg/receivers"
+)
+
+// Single face, as packed by OpenSeeFace's facetracker.py.
+// All values are little-endian, with no padding between them.
+type face struct {
+	Timestamp     float64
+	ID            int32
+	Width         float32 // Width of the source video
+	Height        float32 // Height of the source video
+	EyeBlinkRight float32 // How open the right eye is, from 0 to 1
+	EyeBlinkLeft  float32 // How open the left eye is, from 0 to 1
+	Success       uint8   // 1 if the face was tracked successfully
+	PnPError      float32
+	Quaternion    [4]float32 // Head rotation X, Y, Z, W, in camera space
+	Euler         [3]float32 // Head rotation, in degrees
+	Translation   [3]float32 // Head translation, in camera space
+	Confidence    [68]float32
+	Landmarks     [68][2]float32 // Landmarks Y, X, in pixels of the source video
+	Points3D      [70][3]float32
+	Features      features
+}
+
+// Features estimated from landmarks, each roughly from -1 to 1
+type features struct {
+	EyeLeft            float32
+	EyeRight           float32
+	EyebrowSteepnessL  float32
+	EyebrowUpDownL     float32
+	EyebrowQuirkL      float32
+	EyebrowSteepnessR  float32
+	EyebrowUpDownR     float32
+	EyebrowQuirkR      float32
+	MouthCornerUpDownL float32
+	MouthCornerInOutL  float32
+	MouthCornerUpDownR float32
+	MouthCornerInOutR  float32
+	MouthOpen          float32
+	MouthWide          float32
+}
+
+var (
+	faceSize = binary.Size(face{}) // Size in bytes of a single face in a packet
+)
+
+// Receives face data from OpenSeeFace
+type Receiver struct {
+	*receivers.Base
+	neutral    obj.QuaternionRotation // Head rotation when looking straight at the camera
+	calibrated bool                   // If the neutral head rotation was captured yet
+}
+
+func init() {
+	receivers.Register("OpenSeeFace", New)
+}
+
+// Turn a single face into head bone rotation and blend shapes
+func (o *Receiver) parseFace(f face) {
+
+	// Nothing useful is sent while the tracker can't see a face
+	if f.Success == 0 {
+		return
+	}
+
+	rotation := obj.QuaternionRotation{
+		X: float64(f.Quaternion[0]),
+		Y: float64(f.Quaternion[1]),
+		Z: float64(f.Quaternion[2]),
+		W: float64(f.Quaternion[3]),
+	}
+
+	// The first tracked face is treated as looking straight at the camera
+	if !o.calibrated {
+		o.neutral = rotation
+		o.calibrated = true
+	}
+
+	// Rotation of the head relative to looking straight at the camera.
+	// Camera space has Y pointing down and Z pointing away, so flip both to match the model.
+	relative := o.neutral.Conjugate().Multiply(rotation)
+	o.VRM().WriteBone("Head", obj.Bone{
+		Rotation: obj.Rotation{
+			Quaternion: obj.QuaternionRotation{
+				X: relative.X,
+				Y: -relative.Y,
+				Z: -relative.Z,
+				W: relative.W,
+			},
+		},
+	})
+
+	mouthOpen := obj.Clamp(float64(f.Features.MouthOpen))
+	mouthWide := obj.Clamp(float64(f.Features.MouthWide))
+
+	o.VRM().WriteBlendShapes(obj.BlendShapes{
+
+		// Blinking is the opposite of how open each eye is
+		obj.BlendShapeBlinkL: obj.BlendShape(obj.Clamp(1 - float64(f.EyeBlinkLeft))),
+		obj.BlendShapeBlinkR: obj.BlendShape(obj.Clamp(1 - float64(f.EyeBlinkRight))),
+
+		// A wide open mouth is "A", a wide and open mouth is "E", and a wide but closed mouth is "I"
+		obj.BlendShapeA: obj.BlendShape(mouthOpen * (1 - mouthWide)),
+		obj.BlendShapeE: obj.BlendShape(mouthOpen * mouthWide),
+		obj.BlendShapeI: obj.BlendShape((1 - mouthOpen) * mouthWide),
+
+		// Raised brows go up at the outer corners, and lowered brows go down
+		obj.BlendShapeBrowOuterUpL: obj.BlendShape(obj.Clamp(float64(f.Features.EyebrowUpDownL))),
+		obj.BlendShapeBrowOuterUpR: obj.BlendShape(obj.Clamp(float64(f.Features.EyebrowUpDownR))),
+		obj.BlendShapeBrowDownL:    obj.BlendShape(obj.Clamp(-float64(f.Features.EyebrowUpDownL))),
+		obj.BlendShapeBrowDownR:    obj.BlendShape(obj.Clamp(-float64(f.Features.EyebrowUpDownR))),
+	})
+
+}
+
+// Parse a full packet, which may contain more than one face.
+func (o *Receiver) parsePacket(packet []byte) {
+
+	for len(packet) >= faceSize {
+
+		var f face
+		if err := binary.Read(bytes.NewReader(packet[:faceSize]), binary.LittleEndian, &f); err != nil {
+			log.Println(err)
+			return
+		}
+		packet = packet[faceSize:]
+
+		// Only follow the first face
+		if f.ID != 0 {
+			continue
+		}
+
+		o.parseFace(f)
+
+	}
+
+}
+
+// Bind to the OpenSeeFace address, returning a function that receives packets until the context is cancelled
+func (o *Receiver) listenUDP(ctx context.Context) (func(), error) {
+
+	address := o.Listen(o.AppConfig.OSFListen)
+
+	// Listen for packets of face data
+	conn, err := net.ListenPacket("udp", address.String())
+	if err != nil {
+		return nil, err
+	}
+
+	o.calibrated = false
+
+	log.Printf("Listening for OpenSeeFace model transformation data on %s", address)
+
+	return func() {
+
+		defer conn.Close()
+
+		// Stop listening once cancelled
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+
+		connBuf := make([]byte, 65535)
+		for {
+
+			n, addr, err := conn.ReadFrom(connBuf)
+			if err != nil {
+				if ctx.Err() == nil {
+					o.Fail(err)
+				}
+				break
+			}
+			o.Received(addr.String())
+
+			o.parsePacket(connBuf[:n])
+
+		}
+
+	}, nil
+
+}
+
+// Start receiving in background
+func (o *Receiver) Start(ctx context.Context) error {
+	return o.Run(ctx, o.listenUDP)
+}
+
+// Create a new receiver.
+// Uses OpenSeeFace for webcam face data, sent in its own binary format through UDP.
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
+
+	return &Receiver{
+		Base: receivers.NewBase(env.AppConfig, instance),
+	}, nil
+
+}
@@ -18,37 +18,239 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package receivers
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/thatpix3l/fntwo/pkg/config"
 	"github.com/thatpix3l/fntwo/pkg/obj"
 )
 
-type MotionReceiver struct {
-	AppConfig     *config.App // Pointer an existing app config, for reading various settings.
-	VRM           obj.VRM     // VRM object to transform in 3D space.
-	startCallback func()      // Callback for starting the receiver
-	stopCallback  func()      // Callback for stopping the receiver
+const (
+	RetryInterval = 3 * time.Second // How often receivers built on top of others start the ones that failed again
+)
+
+// Source of motion data, which transforms its own VRM
+type Receiver interface {
+	Start(ctx context.Context) error // Start receiving in background, until stopped or the context is cancelled. May be called again to restart.
+	Stop()                           // Stop receiving, waiting until everything is closed
+	Status() Status                  // Current state of the receiver
+	VRM() *obj.VRM                   // VRM transformed by the receiver
+	Routes() map[string]http.Handler // Routes to mount on the main API server, by path
+}
+
+// Everything a receiver may need when being created
+type Env struct {
+	AppConfig   *config.App         // Pointer an existing app config, for reading various settings.
+	SceneConfig *config.Scene       // Pointer to the live scene config
+	Receivers   map[string]Receiver // Every receiver by name, for receivers built on top of others
+}
+
+// Creates a new receiver of a registered type
+type Factory func(env Env, instance config.ReceiverInstance) (Receiver, error)
+
+var (
+	registry      = make(map[string]Factory) // Every registered type of receiver, by name
+	registryMutex sync.Mutex
+)
+
+// Register a type of receiver, usually from the init of its package
+func Register(kind string, factory Factory) {
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, exists := registry[kind]; exists {
+		panic(fmt.Sprintf("receiver type \"%s\" registered twice", kind))
+	}
+
+	registry[kind] = factory
+
+}
+
+// Name of every registered type of receiver, sorted
+func Types() []string {
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	var kinds []string
+	for kind := range registry {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	return kinds
+
+}
+
+// Create a new receiver from a configured instance
+func Build(env Env, instance config.ReceiverInstance) (Receiver, error) {
+
+	registryMutex.Lock()
+	factory, ok := registry[instance.Type]
+	registryMutex.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("receiver type \"%s\" does not exist", instance.Type)
+	}
+
+	return factory(env, instance)
+
+}
+
+// Common parts of every receiver, meant to be embedded
+type Base struct {
+	AppConfig *config.App             // Pointer an existing app config, for reading various settings.
+	Instance  config.ReceiverInstance // Configured instance this receiver was created from
+	vrm       obj.VRM                 // VRM object to transform in 3D space.
+	routes    map[string]http.Handler // Routes to mount on the main API server, by path
+	lifecycle sync.Mutex              // Held while starting or stopping, so only one happens at a time
+	mutex     sync.Mutex              // Guards everything below
+	cancel    context.CancelFunc      // Cancels the context of the current run, if any
+	done      chan struct{}           // Closed once the current run has finished
+	running   bool                    // If the receiver is running
+	runs      uint64                  // Number of times the receiver was run, to tell runs apart
+	health    health                  // What the receiver has been receiving, for its status
+}
+
+// Create the common parts of a receiver
+func NewBase(appConfig *config.App, instance config.ReceiverInstance) *Base {
+
+	return &Base{
+		AppConfig: appConfig,
+		Instance:  instance,
+		vrm:       obj.NewVRM(),
+		routes:    make(map[string]http.Handler),
+	}
+
+}
+
+// VRM transformed by the receiver
+func (b *Base) VRM() *obj.VRM {
+	return &b.vrm
 }
 
-// Create a new motion receiver.
-func New(appConfig *config.App, start func(), stop func()) *MotionReceiver {
+// Routes to mount on the main API server, by path
+func (b *Base) Routes() map[string]http.Handler {
+	return b.routes
+}
+
+// Mount a handler on the main API server, at the given path.
+// Instances other than the default of their type get their name added to the path, so they don't clash.
+func (b *Base) Mount(path string, handler http.Handler) {
+
+	if b.Instance.Name != b.Instance.Type {
+		path += "/" + b.Instance.Name
+	}
+
+	b.routes[path] = handler
+
+}
+
+// Address to listen on, which is the instance's own if it has one
+func (b *Base) Listen(fallback config.Address) config.Address {
+
+	if b.Instance.Listen != "" {
+		return b.Instance.Listen
+	}
+
+	return fallback
+
+}
+
+// Address of the device to ask for data, which is the instance's own if it has one
+func (b *Base) Device(fallback config.Address) config.Address {
+
+	if b.Instance.Device != "" {
+		return b.Instance.Device
+	}
+
+	return fallback
+
+}
 
-	return &MotionReceiver{
-		AppConfig:     appConfig,
-		VRM:           obj.NewVRM(),
-		startCallback: start,
-		stopCallback:  stop,
+// Run the receiver, stopping any previous run first.
+// Start is called right away, and should do anything that may fail, like binding to an address, before returning.
+// The function it returns is then run in background until it returns, the receiver is stopped, or the context is cancelled.
+func (b *Base) Run(ctx context.Context, start func(ctx context.Context) (func(), error)) error {
+
+	b.lifecycle.Lock()
+	defer b.lifecycle.Unlock()
+
+	b.stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	run, err := start(ctx)
+	if err != nil {
+		cancel()
+		err = fmt.Errorf("%s: %w", b.Instance.Name, err)
+		b.health.fail(err)
+		return err
 	}
+	b.health.reset()
+
+	done := make(chan struct{})
+
+	b.mutex.Lock()
+	b.cancel = cancel
+	b.done = done
+	b.running = true
+	b.runs++
+	current := b.runs
+	b.mutex.Unlock()
+
+	go func() {
+
+		defer close(done)
+
+		run()
+		cancel()
+
+		// Only mark as stopped if nothing else was started since
+		b.mutex.Lock()
+		if b.runs == current {
+			b.running = false
+			b.cancel = nil
+			b.done = nil
+		}
+		b.mutex.Unlock()
+
+	}()
+
+	return nil
 
 }
 
-// Start motion receiver in background
-func (m *MotionReceiver) Start() *MotionReceiver {
-	go m.startCallback()
-	return m
+// Stop the receiver, cancelling the context of the current run and waiting for it to finish
+func (b *Base) Stop() {
+
+	b.lifecycle.Lock()
+	defer b.lifecycle.Unlock()
+
+	b.stop()
+
 }
 
-// Stop motion receiver in background
-func (m *MotionReceiver) Stop() *MotionReceiver {
-	m.stopCallback()
-	return m
+// Same as Stop, but must be called with the lifecycle mutex held
+func (b *Base) stop() {
+
+	b.mutex.Lock()
+	cancel := b.cancel
+	done := b.done
+	b.cancel = nil
+	b.done = nil
+	b.running = false
+	b.mutex.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	<-done
+
 }
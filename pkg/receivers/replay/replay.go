@@ -0,0 +1,289 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/helper"
+	"github.com/thatpix3l/fntwo/pkg/receivers"
+	"github.com/thatpix3l/fntwo/pkg/recorder"
+)
+
+// Playback state, as read and written through the API
+type state struct {
+	File     string  `json:"file"`     // Recording being played back
+	Playing  bool    `json:"playing"`  // If playback is moving forward, instead of paused
+	Position float64 `json:"position"` // Current time in the recording, in seconds
+	Duration float64 `json:"duration"` // Length of the recording, in seconds
+	Speed    float64 `json:"speed"`    // How fast the recording is played back, where 1 is real-time
+	Loop     bool    `json:"loop"`     // If playback starts over once the recording ends
+}
+
+// Changes to playback state. Anything left out is not changed.
+type stateChange struct {
+	File     *string  `json:"file"`
+	Playing  *bool    `json:"playing"`
+	Position *float64 `json:"position"`
+	Speed    *float64 `json:"speed"`
+	Loop     *bool    `json:"loop"`
+}
+
+// Plays back recorded motion data
+type Receiver struct {
+	*receivers.Base
+	stateMutex sync.Mutex          // Guards everything below
+	file       string              // Recording to play back, as a name or path
+	speed      float64             // How fast the recording is played back, where 1 is real-time
+	loop       bool                // If playback starts over once the recording ends
+	recording  *recorder.Recording // Recording being played back, if any
+	loadedFile string              // Name or path the recording was loaded from
+	position   float64             // Current time in the recording, in seconds
+	paused     bool                // If playback is paused
+}
+
+func init() {
+	receivers.Register("Replay", New)
+}
+
+// Load a recording from its path and rewind to its start. Must be called with stateMutex held.
+func (p *Receiver) load(file string, path string) error {
+
+	loaded, err := recorder.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if len(loaded.Frames) == 0 {
+		return errors.New("recording has no frames")
+	}
+
+	p.recording = loaded
+	p.loadedFile = file
+	p.position = 0
+
+	log.Printf("Loaded recording %s, %.1f seconds long", file, p.recording.Duration())
+
+	return nil
+
+}
+
+// Current playback state. Must be called with stateMutex held.
+func (p *Receiver) currentState() state {
+
+	current := state{
+		File:     p.loadedFile,
+		Playing:  p.recording != nil && !p.paused,
+		Position: p.position,
+		Speed:    p.speed,
+		Loop:     p.loop,
+	}
+
+	if p.recording != nil {
+		current.Duration = p.recording.Duration()
+	}
+
+	return current
+
+}
+
+// Move playback forward and write the frame at the new position
+func (p *Receiver) advance(elapsed time.Duration) {
+
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+
+	if p.recording == nil {
+		return
+	}
+
+	if !p.paused {
+
+		p.position += elapsed.Seconds() * p.speed
+
+		// Wrap around or hold the last frame once either end is reached
+		duration := p.recording.Duration()
+		switch {
+		case p.position > duration && p.loop && duration > 0:
+			p.position = math.Mod(p.position, duration)
+		case p.position > duration:
+			p.position = duration
+		case p.position < 0 && p.loop && duration > 0:
+			p.position = math.Mod(p.position, duration) + duration
+		case p.position < 0:
+			p.position = 0
+		}
+
+	}
+
+	p.VRM().WriteFrame(p.recording.At(p.position))
+	p.Received("")
+
+}
+
+// Load the recording, returning a function that plays it back until the context is cancelled
+func (p *Receiver) play(ctx context.Context) (func(), error) {
+
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+
+	// Load the configured recording, unless one was already picked through the API.
+	// The configured recording may be any path, as it comes from whoever started fntwo.
+	if p.recording == nil || p.loadedFile != p.file {
+
+		if p.file == "" {
+			return nil, errors.New("no recording to play back")
+		}
+
+		if err := p.load(p.file, recorder.Resolve(p.AppConfig.RecordingsDirPath, p.file)); err != nil {
+			return nil, err
+		}
+
+	}
+
+	log.Println("Playing back recorded model transformation data")
+
+	return func() {
+
+		ticker := time.NewTicker(time.Duration(1e9 / p.AppConfig.ModelUpdateFrequency))
+		defer ticker.Stop()
+
+		last := time.Now()
+		for {
+
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				p.advance(now.Sub(last))
+				last = now
+			}
+
+		}
+
+	}, nil
+
+}
+
+// Read or change playback state. GET returns the current state, PATCH changes it.
+func (p *Receiver) handleAPI(w http.ResponseWriter, r *http.Request) {
+
+	helper.AllowHTTPAllPerms(&w)
+
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+
+	switch r.Method {
+	case http.MethodOptions:
+		return
+	case http.MethodGet:
+	case http.MethodPatch:
+
+		var change stateChange
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Only recordings in the recordings directory may be picked through the API
+		if change.File != nil {
+
+			path, err := recorder.Path(p.AppConfig.RecordingsDirPath, *change.File)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := p.load(*change.File, path); err != nil {
+				log.Println(err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			p.file = *change.File
+
+		}
+
+		if change.Speed != nil {
+			p.speed = *change.Speed
+		}
+
+		if change.Loop != nil {
+			p.loop = *change.Loop
+		}
+
+		if change.Playing != nil {
+			p.paused = !*change.Playing
+		}
+
+		// Seek, keeping within the recording
+		if change.Position != nil && p.recording != nil {
+			p.position = *change.Position
+			if p.position < 0 {
+				p.position = 0
+			}
+			if p.position > p.recording.Duration() {
+				p.position = p.recording.Duration()
+			}
+			p.VRM().WriteFrame(p.recording.At(p.position))
+		}
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bytes, err := json.Marshal(p.currentState())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+
+}
+
+// Start receiving in background
+func (p *Receiver) Start(ctx context.Context) error {
+	return p.Run(ctx, p.play)
+}
+
+// Create a new receiver.
+// Plays back motion recorded to disk, as if it were coming from a live source.
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
+
+	// Playback state is only read from the config once, as it's then changed through the API
+	p := &Receiver{
+		Base:  receivers.NewBase(env.AppConfig, instance),
+		file:  env.AppConfig.ReplayFile,
+		speed: env.AppConfig.ReplaySpeed,
+		loop:  env.AppConfig.ReplayLoop,
+	}
+	p.Mount("/api/replay", http.HandlerFunc(p.handleAPI))
+
+	return p, nil
+
+}
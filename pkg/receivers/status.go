@@ -0,0 +1,196 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package receivers
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	staleAfter = time.Second // How long a running receiver can go without data before it's stale
+)
+
+// Overall state of a receiver
+type State string
+
+const (
+	StateStopped   State = "stopped"   // Not running
+	StateListening State = "listening" // Running, but nothing was received yet
+	StateConnected State = "connected" // Running, and receiving data
+	StateStale     State = "stale"     // Running, but data stopped coming in
+	StateError     State = "error"     // Not running, because of an error
+)
+
+// Current state of a receiver
+type Status struct {
+	Name             string     `json:"name"`               // Name of the receiver
+	Type             string     `json:"type"`               // Registered type of the receiver
+	State            State      `json:"state"`              // Overall state of the receiver
+	Running          bool       `json:"running"`            // If the receiver was started, and hasn't stopped since
+	Remote           string     `json:"remote"`             // Address data was last received from, if it came over the network
+	PacketsPerSecond float64    `json:"packets_per_second"` // How often data is being received
+	LastFrame        *time.Time `json:"last_frame"`         // When data was last received, if at all since starting
+	LastError        string     `json:"last_error"`         // Last error the receiver ran into, if any since starting
+}
+
+// What a receiver has been receiving
+type health struct {
+	mutex       sync.Mutex
+	lastFrame   time.Time // When data was last received
+	remote      string    // Address data was last received from
+	lastError   string    // Last error, if any
+	windowStart time.Time // When packets started being counted for the current rate
+	windowCount int       // Packets received since the window started
+	rate        float64   // Packets per second of the previous window
+}
+
+// Forget everything, e.g. when starting again
+func (h *health) reset() {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.lastFrame = time.Time{}
+	h.remote = ""
+	h.lastError = ""
+	h.windowStart = time.Now()
+	h.windowCount = 0
+	h.rate = 0
+
+}
+
+// Count a single packet
+func (h *health) received(remote string) {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := time.Now()
+	h.lastFrame = now
+	if remote != "" {
+		h.remote = remote
+	}
+
+	// Packets are counted over windows of about a second
+	h.windowCount++
+	if elapsed := now.Sub(h.windowStart); elapsed >= time.Second {
+		h.rate = float64(h.windowCount) / elapsed.Seconds()
+		h.windowStart = now
+		h.windowCount = 0
+	}
+
+}
+
+// Remember an error
+func (h *health) fail(err error) {
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.lastError = err.Error()
+
+}
+
+// Mark that data was received, from a remote address if it came over the network.
+// Called by receivers for every packet or frame.
+func (b *Base) Received(remote string) {
+	b.health.received(remote)
+}
+
+// Log an error, and remember it for the status of the receiver
+func (b *Base) Fail(err error) {
+	log.Println(err)
+	b.health.fail(err)
+}
+
+// Current state of the receiver
+func (b *Base) Status() Status {
+
+	b.mutex.Lock()
+	running := b.running
+	b.mutex.Unlock()
+
+	h := &b.health
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	status := Status{
+		Name:      b.Instance.Name,
+		Type:      b.Instance.Type,
+		Running:   running,
+		Remote:    h.remote,
+		LastError: h.lastError,
+	}
+
+	if !h.lastFrame.IsZero() {
+		lastFrame := h.lastFrame
+		status.LastFrame = &lastFrame
+	}
+
+	// Once packets stop, the previous rate no longer holds
+	if elapsed := time.Since(h.windowStart); elapsed >= 2*time.Second {
+		status.PacketsPerSecond = float64(h.windowCount) / elapsed.Seconds()
+	} else {
+		status.PacketsPerSecond = h.rate
+	}
+
+	switch {
+	case !running && h.lastError != "":
+		status.State = StateError
+	case !running:
+		status.State = StateStopped
+	case h.lastFrame.IsZero():
+		status.State = StateListening
+	case time.Since(h.lastFrame) > staleAfter:
+		status.State = StateStale
+	default:
+		status.State = StateConnected
+	}
+
+	return status
+
+}
+
+// Packet connection that marks every packet read from it as received
+type countingConn struct {
+	net.PacketConn
+	base *Base
+}
+
+func (c countingConn) ReadFrom(p []byte) (int, net.Addr, error) {
+
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err == nil && addr != nil {
+		c.base.Received(addr.String())
+	}
+
+	return n, addr, err
+
+}
+
+// Wrap a packet connection, so every packet read from it is marked as received.
+// Meant for connections handed to something else to read from, like an OSC server.
+func (b *Base) CountPackets(conn net.PacketConn) net.PacketConn {
+	return countingConn{
+		PacketConn: conn,
+		base:       b,
+	}
+}
@@ -18,8 +18,11 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package virtualmotioncapture
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
+	"sync"
 	"unicode"
 
 	"github.com/hypebeast/go-osc/osc"
@@ -28,41 +31,85 @@ import (
 	"github.com/thatpix3l/fntwo/pkg/receivers"
 )
 
-var (
-	vmcReceiver *receivers.MotionReceiver
-	server      *osc.Server
-)
+// Receives VRM data from other applications in the VMC protocol format, acting as a VMC "marionette"
+type Receiver struct {
+	*receivers.Base
+	sceneConfig             *config.Scene   // Scene config, for camera and light messages
+	pendingBlendShapes      obj.BlendShapes // Blend shapes waiting for the next "Apply" message
+	pendingBlendShapesMutex sync.Mutex
+}
+
+func init() {
+	receivers.Register("VirtualMotionCapture", New)
+}
 
 // Assuming everything after the first index is bone data, type assert it as a slice of float32
 // The positioning of the data is special, where the index is as follows:
 // index 0, 1, 2: bone position X, Y, Z
 // index 3, 4, 5, 6: bone quaternion rotation X, Y, Z, W
+// Some messages, like the root transform, may contain more data after these.
 func parseBone(msg *osc.Message) ([]float64, error) {
 
+	// The first argument is the name, so there's nothing to parse without it
+	if len(msg.Arguments) < 2 {
+		return nil, fmt.Errorf("Not enough bone coords in OSC message: %s", msg)
+	}
+
 	// Slice of bone data parameters
 	var boneData []float64
 
 	// For each OSC message index, skipping the first index...
 	for _, v := range msg.Arguments[1:] {
-		coord, ok := v.(float64)
+		coord, ok := v.(float32)
 		if !ok {
 			return nil, fmt.Errorf("Unable to type assert OSC message as []float32 bone coords: %s", msg)
 		}
 
-		boneData = append(boneData, coord)
+		boneData = append(boneData, float64(coord))
+
+	}
 
+	// Bone data needs at least a position and rotation
+	if len(boneData) < 7 {
+		return nil, fmt.Errorf("Not enough bone coords in OSC message: %s", msg)
 	}
 
 	return boneData, nil
 
 }
 
-// Start listening for VMC messages to modify the VRM data
-func listenVMC() {
+// Convert a position from Unity's left-handed coordinates to ThreeJS's right-handed coordinates
+func toThreePosition(position obj.Position) obj.Position {
+	return obj.Position{
+		X: -position.X,
+		Y: position.Y,
+		Z: position.Z,
+	}
+}
+
+// Convert a rotation from Unity's left-handed coordinates to ThreeJS's right-handed coordinates
+func toThreeRotation(rotation obj.QuaternionRotation) obj.QuaternionRotation {
+	return obj.QuaternionRotation{
+		X: rotation.X,
+		Y: -rotation.Y,
+		Z: -rotation.Z,
+		W: rotation.W,
+	}
+}
+
+// Bind to the VMC address, returning a function that handles VMC messages to modify the VRM data until the context is cancelled
+func (v *Receiver) listen(ctx context.Context) (func(), error) {
+
+	address := v.Listen(v.AppConfig.VMCListen)
+
+	// Bind now, so failures are reported to whoever started the receiver
+	conn, err := net.ListenPacket("udp", address.String())
+	if err != nil {
+		return nil, err
+	}
 
 	// Listen for face and bone data through OSC from a device in the VMC protocol format
-	log.Println(vmcReceiver.AppConfig.APIListen)
-	log.Printf("Listening for VMC model transformation data on %s", vmcReceiver.AppConfig.VMCListen)
+	log.Printf("Listening for VMC model transformation data on %s", address)
 
 	d := osc.NewStandardDispatcher()
 
@@ -71,6 +118,11 @@ func listenVMC() {
 	// BlendShapes handler
 	d.AddMsgHandler("/VMC/Ext/Blend/Val", func(msg *osc.Message) {
 
+		// Needs both a name and a value
+		if len(msg.Arguments) < 2 {
+			return
+		}
+
 		// Get key name
 		key, ok := msg.Arguments[0].(string)
 		if !ok {
@@ -92,16 +144,83 @@ func listenVMC() {
 			value = 0
 		}
 
-		vmcReceiver.VRM.WriteBlendShape(key, obj.BlendShape(value))
+		// Hold onto the blend shape until every blend shape of the frame has arrived
+		v.pendingBlendShapesMutex.Lock()
+		v.pendingBlendShapes[key] = obj.BlendShape(value)
+		v.pendingBlendShapesMutex.Unlock()
+
+	})
+
+	// Apply all blend shapes received since the last apply, all at once
+	d.AddMsgHandler("/VMC/Ext/Blend/Apply", func(msg *osc.Message) {
+
+		v.pendingBlendShapesMutex.Lock()
+		defer v.pendingBlendShapesMutex.Unlock()
+
+		v.VRM().WriteBlendShapes(v.pendingBlendShapes)
+		v.pendingBlendShapes = make(obj.BlendShapes)
+
+	})
+
+	// Root position and rotation request handler
+	d.AddMsgHandler("/VMC/Ext/Root/Pos", func(msg *osc.Message) {
+
+		// Root transformation parameters slice
+		value, err := parseBone(msg)
+		if err != nil {
+			return
+		}
+
+		// New root structure
+		root := obj.Root{
+			Position: obj.Position{
+				X: value[0],
+				Y: value[1],
+				Z: value[2],
+			},
+			Rotation: obj.Rotation{
+				Quaternion: obj.QuaternionRotation{
+					X: value[3],
+					Y: value[4],
+					Z: value[5],
+					W: value[6],
+				},
+			},
+			Scale: obj.Position{
+				X: 1,
+				Y: 1,
+				Z: 1,
+			},
+		}
+
+		// Newer versions of the protocol also send the scale and offset
+		if len(value) >= 13 {
+			root.Scale = obj.Position{
+				X: value[7],
+				Y: value[8],
+				Z: value[9],
+			}
+			root.Offset = obj.Position{
+				X: value[10],
+				Y: value[11],
+				Z: value[12],
+			}
+		}
+
+		v.VRM().WriteRoot(root)
 
 	})
 
 	// Bone position and rotation request handler
 	d.AddMsgHandler("/VMC/Ext/Bone/Pos", func(msg *osc.Message) {
 
+		if len(msg.Arguments) == 0 {
+			return
+		}
+
 		// Bone name
 		key, ok := msg.Arguments[0].(string)
-		if !ok {
+		if !ok || key == "" {
 			return
 		}
 
@@ -132,30 +251,190 @@ func listenVMC() {
 		}
 
 		// Attach bone to the receiver's referenced bone map
-		vmcReceiver.VRM.WriteBone(key, bone)
+		v.VRM().WriteBone(key, bone)
+
+	})
+
+	// Tracked device position and rotation handlers, for each kind of device
+	for address, kind := range map[string]string{
+		"/VMC/Ext/Hmd/Pos": obj.TrackerHMD,
+		"/VMC/Ext/Con/Pos": obj.TrackerController,
+		"/VMC/Ext/Tra/Pos": obj.TrackerGeneric,
+	} {
+
+		kind := kind
+		d.AddMsgHandler(address, func(msg *osc.Message) {
+
+			if len(msg.Arguments) == 0 {
+				return
+			}
+
+			// Serial number of the device
+			serial, ok := msg.Arguments[0].(string)
+			if !ok {
+				return
+			}
+
+			// Tracker transformation parameters slice
+			value, err := parseBone(msg)
+			if err != nil {
+				return
+			}
+
+			tracker := obj.Tracker{
+				Kind: kind,
+				Position: obj.Position{
+					X: value[0],
+					Y: value[1],
+					Z: value[2],
+				},
+				Rotation: obj.Rotation{
+					Quaternion: obj.QuaternionRotation{
+						X: value[3],
+						Y: value[4],
+						Z: value[5],
+						W: value[6],
+					},
+				},
+			}
+
+			v.VRM().WriteTracker(serial, tracker)
+
+		})
+
+	}
+
+	// Camera position, rotation and FOV request handler
+	d.AddMsgHandler("/VMC/Ext/Cam", func(msg *osc.Message) {
+
+		// Only follow the sender's camera if explicitly allowed
+		if !v.AppConfig.VMCCamera {
+			return
+		}
+
+		// Camera transformation parameters slice, with FOV at the end
+		value, err := parseBone(msg)
+		if err != nil || len(value) < 8 {
+			return
+		}
+
+		gazeFrom := toThreePosition(obj.Position{
+			X: value[0],
+			Y: value[1],
+			Z: value[2],
+		})
+
+		rotation := obj.QuaternionRotation{
+			X: value[3],
+			Y: value[4],
+			Z: value[5],
+			W: value[6],
+		}
+
+		// Keep the same distance between the camera and what it's looking at, defaulting to 1 if there's none
+		current := v.sceneConfig.ReadCamera()
+		distance := current.GazeTowards.Sub(current.GazeFrom).Length()
+		if distance == 0 {
+			distance = 1
+		}
+
+		// Unity cameras look towards their forward direction, which is positive Z
+		forward := toThreePosition(rotation.Rotate(obj.Position{Z: 1}))
+
+		camera := obj.Camera{
+			GazeFrom:    gazeFrom,
+			GazeTowards: gazeFrom.Add(forward.Scale(distance)),
+			FOV:         value[7],
+		}
+
+		// Only notify clients if something actually changed
+		if camera == current {
+			return
+		}
+
+		v.sceneConfig.WriteCamera(camera)
+		v.sceneConfig.Update()
+
+	})
+
+	// Light position, rotation and color request handler
+	d.AddMsgHandler("/VMC/Ext/Light", func(msg *osc.Message) {
+
+		// Light transformation parameters slice, with RGBA color at the end
+		value, err := parseBone(msg)
+		if err != nil || len(value) < 11 {
+			return
+		}
+
+		light := obj.Light{
+			Position: toThreePosition(obj.Position{
+				X: value[0],
+				Y: value[1],
+				Z: value[2],
+			}),
+			Rotation: obj.Rotation{
+				Quaternion: toThreeRotation(obj.QuaternionRotation{
+					X: value[3],
+					Y: value[4],
+					Z: value[5],
+					W: value[6],
+				}),
+			},
+			Color: obj.Color{
+				R: value[7],
+				G: value[8],
+				B: value[9],
+				A: value[10],
+			},
+		}
+
+		// Only notify clients if something actually changed
+		if light == v.sceneConfig.ReadLight() {
+			return
+		}
+
+		v.sceneConfig.WriteLight(light)
+		v.sceneConfig.Update()
 
 	})
 
 	// OSC server configuration
-	server = &osc.Server{
-		Addr:       vmcReceiver.AppConfig.VMCListen.String(),
+	server := &osc.Server{
+		Addr:       address.String(),
 		Dispatcher: d,
 	}
 
-	// Blocking listen and serve
-	server.ListenAndServe()
+	return func() {
+
+		// Stop listening once cancelled. The connection is our own, so the server can be started again later.
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+
+		// Blocking serve, counting every packet for the status of the receiver
+		if err := server.Serve(v.CountPackets(conn)); err != nil && ctx.Err() == nil {
+			v.Fail(err)
+		}
+
+	}, nil
 
 }
 
-func stopListening() {
-	server.CloseConnection()
+// Start receiving in background
+func (v *Receiver) Start(ctx context.Context) error {
+	return v.Run(ctx, v.listen)
 }
 
-// Create a new MotionReceiver.
+// Create a new receiver.
 // Uses the VMC protocol, a subset of the OSC protocol, which internally uses UDP for low-latency motion parsing.
-func New(appConfig *config.App) *receivers.MotionReceiver {
-
-	vmcReceiver = receivers.New(appConfig, listenVMC, stopListening)
-	return vmcReceiver
+// Camera and light messages are written to the scene config.
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
+
+	return &Receiver{
+		Base:               receivers.NewBase(env.AppConfig, instance),
+		sceneConfig:        env.SceneConfig,
+		pendingBlendShapes: make(obj.BlendShapes),
+	}, nil
 
 }
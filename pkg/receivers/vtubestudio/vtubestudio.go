@@ -0,0 +1,230 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package vtubestudio
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net"
+	"time"
+
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/obj"
+	"github.com/thatpix3l/fntwo/pkg/receivers"
+	"github.com/westphae/quaternion"
+)
+
+const (
+	devicePort = "21412" // Port the VTube Studio app listens on for tracking data requests
+)
+
+// Request for the VTube Studio app to send tracking data to one or more of our ports
+type trackingDataRequest struct {
+	MessageType string  `json:"messageType"` // Always "iOSTrackingDataRequest", even for Android
+	Time        float64 `json:"time"`        // Seconds the app should keep sending data for
+	SentBy      string  `json:"sentBy"`      // Name of the requesting app
+	Ports       []int   `json:"ports"`       // Ports to send tracking data to
+}
+
+type vector struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+type blendShape struct {
+	Key   string  `json:"k"`
+	Value float64 `json:"v"`
+}
+
+// Frame of tracking data sent by the VTube Studio app
+type trackingData struct {
+	Timestamp   int64        `json:"Timestamp"`
+	FaceFound   bool         `json:"FaceFound"`
+	Rotation    vector       `json:"Rotation"` // Head rotation, in degrees
+	Position    vector       `json:"Position"`
+	EyeLeft     vector       `json:"EyeLeft"` // Left eye rotation, in degrees
+	EyeRight    vector       `json:"EyeRight"`
+	BlendShapes []blendShape `json:"BlendShapes"`
+}
+
+// Receives face data from the VTube Studio app
+type Receiver struct {
+	*receivers.Base
+}
+
+func init() {
+	receivers.Register("VTubeStudio", New)
+}
+
+// Convert a rotation in degrees to a bone
+func newBone(rotation vector) obj.Bone {
+
+	boneQuat := quaternion.FromEuler(
+		rotation.X*math.Pi/180,
+		rotation.Y*math.Pi/180,
+		-rotation.Z*math.Pi/180,
+	)
+
+	return obj.Bone{
+		Rotation: obj.Rotation{
+			Quaternion: obj.QuaternionRotation{
+				X: boneQuat.X,
+				Y: boneQuat.Y,
+				Z: boneQuat.Z,
+				W: boneQuat.W,
+			},
+		},
+	}
+
+}
+
+// Parse a full frame of motion data.
+func (v *Receiver) parseFrame(frame trackingData) {
+
+	// Nothing useful is sent while the phone can't see a face
+	if !frame.FaceFound {
+		return
+	}
+
+	// Blend shape names are ARKit's, so use the same naming as the other phone apps
+	blendShapes := make(obj.BlendShapes)
+	for _, b := range frame.BlendShapes {
+		blendShapes[obj.ARKitBlendShapeName(b.Key)] = obj.BlendShape(b.Value)
+	}
+	v.VRM().WriteBlendShapes(blendShapes)
+
+	v.VRM().WriteBone("Head", newBone(frame.Rotation))
+	v.VRM().WriteBone("LeftEye", newBone(frame.EyeLeft))
+	v.VRM().WriteBone("RightEye", newBone(frame.EyeRight))
+
+}
+
+// Repeatedly ask the device to send tracking data to our port, closing the connection to it once cancelled
+func (v *Receiver) requestData(ctx context.Context, deviceConn net.Conn, request []byte) {
+
+	defer deviceConn.Close()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+
+		// The device stops sending once the requested time is up, so keep asking before that happens
+		if _, err := deviceConn.Write(request); err != nil {
+			v.Fail(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+	}
+
+}
+
+// Bind to the VTube Studio address and connect to the device,
+// returning a function that receives frames until the context is cancelled
+func (v *Receiver) listenUDP(ctx context.Context) (func(), error) {
+
+	address := v.Listen(v.AppConfig.VTSListen)
+	device := v.Device(v.AppConfig.VTSDevice)
+
+	request, err := json.Marshal(trackingDataRequest{
+		MessageType: "iOSTrackingDataRequest",
+		Time:        3,
+		SentBy:      "fntwo",
+		Ports:       []int{address.Port()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Listen for frames of motion data
+	conn, err := net.ListenPacket("udp", address.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect right away, so an unreachable device is reported to whoever started the receiver
+	deviceConn, err := net.Dial("udp", device.IP()+":"+devicePort)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	log.Printf("Telling device at \"%s\" to send VTube Studio motion data", device.IP())
+	log.Printf("Listening for VTube Studio model transformation data on %s", address)
+
+	return func() {
+
+		defer conn.Close()
+
+		// Stop listening once cancelled
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+
+		go v.requestData(ctx, deviceConn, request)
+
+		connBuf := make([]byte, 8192)
+		for {
+
+			// Each packet is a full frame of data
+			n, addr, err := conn.ReadFrom(connBuf)
+			if err != nil {
+				if ctx.Err() == nil {
+					v.Fail(err)
+				}
+				break
+			}
+			v.Received(addr.String())
+
+			var frame trackingData
+			if err := json.Unmarshal(connBuf[:n], &frame); err != nil {
+				log.Println(err)
+				continue
+			}
+
+			v.parseFrame(frame)
+
+		}
+
+	}, nil
+
+}
+
+// Start receiving in background
+func (v *Receiver) Start(ctx context.Context) error {
+	return v.Run(ctx, v.listenUDP)
+}
+
+// Create a new receiver.
+// Uses the VTube Studio app on iOS or Android for face data. Internally, UDP is used to communicate with a device.
+func New(env receivers.Env, instance config.ReceiverInstance) (receivers.Receiver, error) {
+
+	return &Receiver{
+		Base: receivers.NewBase(env.AppConfig, instance),
+	}, nil
+
+}
@@ -0,0 +1,254 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package recorder
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+var (
+	ErrRecording    = errors.New("already recording")
+	ErrNotRecording = errors.New("not recording")
+	ErrInvalidName  = errors.New("invalid recording name")
+)
+
+// Info about a recording stored on disk
+type Info struct {
+	Name     string    `json:"name"`     // File name of the recording
+	Size     int64     `json:"size"`     // Size of the file, in bytes
+	Modified time.Time `json:"modified"` // When the file was last written to
+}
+
+// Records VRM data to disk, as timestamped frames
+type Recorder struct {
+	AppConfig *config.App      // Pointer an existing app config, for reading various settings.
+	source    func() obj.Frame // Callback to retrieve the frame to record, e.g. the output of the active receiver
+	receiver  func() string    // Callback to retrieve the name of the receiver being recorded
+	mutex     sync.Mutex       // Guards everything below
+	current   string           // Name of the recording in progress, if any
+	stop      chan struct{}    // Closed when the recording in progress should stop
+	done      chan error       // Receives the result of the recording in progress once it stops
+}
+
+// Path to a recording in the recordings directory, making sure the name can't escape it
+func (r *Recorder) Path(name string) (string, error) {
+	return Path(r.AppConfig.RecordingsDirPath, name)
+}
+
+// Name of the recording in progress, or an empty string if not recording
+func (r *Recorder) Current() string {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.current
+
+}
+
+// Write frames to a file until told to stop
+func (r *Recorder) record(file *os.File, stop chan struct{}) error {
+
+	defer file.Close()
+
+	writer := gzip.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	header := Header{
+		Version:   formatVersion,
+		Started:   time.Now(),
+		Frequency: r.AppConfig.ModelUpdateFrequency,
+		Receiver:  r.receiver(),
+	}
+	if err := encoder.Encode(header); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(time.Duration(1e9 / header.Frequency))
+	defer ticker.Stop()
+
+	for {
+
+		select {
+		case <-stop:
+			return writer.Close()
+		case <-ticker.C:
+		}
+
+		frame := Frame{
+			Time:  time.Since(header.Started).Seconds(),
+			Frame: r.source(),
+		}
+
+		if err := encoder.Encode(frame); err != nil {
+			writer.Close()
+			return err
+		}
+
+	}
+
+}
+
+// Start recording in background, returning the name of the new recording
+func (r *Recorder) Start() (string, error) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.current != "" {
+		return "", ErrRecording
+	}
+
+	if err := os.MkdirAll(r.AppConfig.RecordingsDirPath, 0755); err != nil {
+		return "", err
+	}
+
+	// Name recordings after when they started, so they sort in order.
+	// Recordings started within the same second get a counter added, e.g. "_2".
+	started := time.Now().Format("2006-01-02_15-04-05")
+	var (
+		name string
+		path string
+		file *os.File
+	)
+	for count := 1; file == nil; count++ {
+
+		name = started + Extension
+		if count > 1 {
+			name = fmt.Sprintf("%s_%d%s", started, count, Extension)
+		}
+
+		var err error
+		if path, err = r.Path(name); err != nil {
+			return "", err
+		}
+
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+	}
+
+	r.current = name
+	r.stop = make(chan struct{})
+	r.done = make(chan error, 1)
+
+	go func(stop chan struct{}, done chan error) {
+		done <- r.record(file, stop)
+	}(r.stop, r.done)
+
+	log.Printf("Started recording to %s", path)
+
+	return name, nil
+
+}
+
+// Stop recording, returning the name of the finished recording
+func (r *Recorder) Stop() (string, error) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.current == "" {
+		return "", ErrNotRecording
+	}
+
+	// Wait for the last frames to be flushed
+	close(r.stop)
+	err := <-r.done
+
+	name := r.current
+	r.current = ""
+
+	if err != nil {
+		return name, err
+	}
+
+	log.Printf("Stopped recording %s", name)
+
+	return name, nil
+
+}
+
+// List every recording on disk, oldest first
+func (r *Recorder) List() ([]Info, error) {
+
+	entries, err := os.ReadDir(r.AppConfig.RecordingsDirPath)
+	if os.IsNotExist(err) {
+		return []Info{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recordings := []Info{}
+	for _, entry := range entries {
+
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), Extension) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		recordings = append(recordings, Info{
+			Name:     entry.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		})
+
+	}
+
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].Name < recordings[j].Name
+	})
+
+	return recordings, nil
+
+}
+
+// Create a new recorder.
+// The source callback is run every frame, to retrieve the frame to record.
+// The receiver callback is run once per recording, to name whichever receiver is the source.
+func New(appConfig *config.App, source func() obj.Frame, receiver func() string) *Recorder {
+
+	return &Recorder{
+		AppConfig: appConfig,
+		source:    source,
+		receiver:  receiver,
+	}
+
+}
@@ -0,0 +1,174 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+const (
+	formatVersion = 1           // Version of the recording format, bumped on breaking changes
+	Extension     = ".fntwo.gz" // Extension of every recording file
+)
+
+// First line of every recording, describing the rest of it
+type Header struct {
+	Version   int       `json:"version"`   // Version of the recording format
+	Started   time.Time `json:"started"`   // When the recording started
+	Frequency int       `json:"frequency"` // Times per second a frame was recorded
+	Receiver  string    `json:"receiver"`  // Name of the receiver being recorded when the recording started
+}
+
+// Single recorded frame of VRM data
+type Frame struct {
+	Time float64 `json:"t"` // Seconds since the recording started
+	obj.Frame
+}
+
+// Recording loaded into memory
+type Recording struct {
+	Header
+	Frames []Frame
+}
+
+// Path to a recording in a recordings directory, making sure the name can't escape it
+func Path(dir string, name string) (string, error) {
+
+	if name == "" || name != filepath.Base(name) || !strings.HasSuffix(name, Extension) {
+		return "", ErrInvalidName
+	}
+
+	return filepath.Join(dir, name), nil
+
+}
+
+// Resolve a recording name to its path. Bare names are looked up in the recordings directory.
+// Anything else is used as a path as-is, so this is only meant for names given on the command line.
+func Resolve(dir string, file string) string {
+
+	if filepath.Base(file) == file {
+		return filepath.Join(dir, file)
+	}
+
+	return file
+
+}
+
+// Load a recording from disk.
+// Recordings are gzipped JSON lines, where the first line is the header and every other line is a frame.
+func Open(path string) (*Recording, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(reader))
+
+	var recording Recording
+	if err := decoder.Decode(&recording.Header); err != nil {
+		return nil, err
+	}
+
+	if recording.Version != formatVersion {
+		return nil, errors.New("unsupported recording version")
+	}
+
+	for {
+
+		var frame Frame
+		if err := decoder.Decode(&frame); err != nil {
+
+			// A recording cut short, e.g. by a crash, is still usable up to the last whole frame
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+
+			return nil, err
+
+		}
+
+		recording.Frames = append(recording.Frames, frame)
+
+	}
+
+	return &recording, nil
+
+}
+
+// Length of the recording, in seconds
+func (r *Recording) Duration() float64 {
+
+	if len(r.Frames) == 0 {
+		return 0
+	}
+
+	return r.Frames[len(r.Frames)-1].Time
+
+}
+
+// Index of the last frame at or before the given time, in seconds
+func (r *Recording) Index(t float64) int {
+
+	i := sort.Search(len(r.Frames), func(i int) bool {
+		return r.Frames[i].Time > t
+	})
+
+	if i > 0 {
+		i--
+	}
+
+	return i
+
+}
+
+// Frame at the given time, in seconds, interpolated between the two nearest recorded frames
+func (r *Recording) At(t float64) obj.Frame {
+
+	if len(r.Frames) == 0 {
+		return obj.Frame{}
+	}
+
+	i := r.Index(t)
+	from := r.Frames[i]
+	if i+1 >= len(r.Frames) || t <= from.Time {
+		return from.Frame
+	}
+
+	to := r.Frames[i+1]
+	return from.Frame.Lerp(to.Frame, (t-from.Time)/(to.Time-from.Time))
+
+}
@@ -18,40 +18,60 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package router
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/export"
 	"github.com/thatpix3l/fntwo/pkg/helper"
-	"github.com/thatpix3l/fntwo/pkg/obj"
 	"github.com/thatpix3l/fntwo/pkg/pool"
 	"github.com/thatpix3l/fntwo/pkg/receivers"
+	"github.com/thatpix3l/fntwo/pkg/receivers/compositor"
+	"github.com/thatpix3l/fntwo/pkg/recorder"
+	"github.com/thatpix3l/fntwo/pkg/visemes"
 	"github.com/thatpix3l/fntwo/pkg/web"
 )
 
+const (
+	statusUpdateInterval = time.Second / 4 // How often receiver status is sent to each client
+)
+
 var (
 	sceneConfig *config.Scene
 	appConfig   *config.App
 )
 
+type recording struct {
+	Name string `json:"name"`
+}
+
+type visemePlayback struct {
+	Duration float64 `json:"duration"`
+}
+
 type receiver struct {
 	Active    string   `json:"active"`
 	Available []string `json:"available"`
 }
 
-// Helper func to allow all origin, headers, and methods for HTTP requests.
-func allowHTTPAllPerms(wPtr *http.ResponseWriter) {
+// Status of every receiver, by name
+func receiverStatus(receiverMap map[string]receivers.Receiver) map[string]receivers.Status {
 
-	// Set CORS policy
-	(*wPtr).Header().Set("Access-Control-Allow-Origin", "*")
-	(*wPtr).Header().Set("Access-Control-Allow-Methods", "*")
-	(*wPtr).Header().Set("Access-Control-Allow-Headers", "*")
+	statuses := make(map[string]receivers.Status)
+	for name, r := range receiverMap {
+		statuses[name] = r.Status()
+	}
+
+	return statuses
 
 }
 
@@ -89,18 +109,23 @@ func saveSceneConfig() error {
 
 }
 
-func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map[string]*receivers.MotionReceiver) *mux.Router {
+func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map[string]receivers.Receiver, active *receivers.Active) *mux.Router {
 
 	appConfig = appConfigPtr
 	sceneConfig = sceneConfigPtr
 
 	// Use picked receiver from user
-	if receiverMap[appConfig.Receiver] == nil {
-		log.Printf("Suggested receiver \"%s\" does not exist!", appConfig.Receiver)
+	_, activeReceiver := active.Get()
+	if err := activeReceiver.Start(context.Background()); err != nil {
+		log.Println(err)
 	}
 
-	activeReceiver := receiverMap[appConfig.Receiver]
-	activeReceiver.Start()
+	// Recorder of whichever receiver is active
+	motionRecorder := recorder.New(appConfig, active.Frame, active.Name)
+
+	// Mouth shapes from text-to-speech, played over whichever receiver is active
+	visemePlayer := visemes.New()
+	active.AddOverlay(visemePlayer.Overlay)
 
 	// Router for API and web frontend
 	router := mux.NewRouter()
@@ -111,7 +136,7 @@ func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map
 		log.Println("Adding new camera reader client...")
 
 		// On first-time connect, send the camera state
-		if err := ws.WriteJSON(sceneConfig.Camera); err != nil {
+		if err := ws.WriteJSON(sceneConfig.ReadCamera()); err != nil {
 			log.Println(err)
 			return
 		}
@@ -120,7 +145,7 @@ func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map
 		sceneConfig.Create(func(client *pool.Client) {
 
 			// Write camera data to connected frontend client
-			if err := ws.WriteJSON(sceneConfig.Camera); err != nil {
+			if err := ws.WriteJSON(sceneConfig.ReadCamera()); err != nil {
 				log.Println(err)
 				client.Delete()
 				ws.Close()
@@ -136,37 +161,60 @@ func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map
 
 		for {
 
-			if err := ws.ReadJSON(&sceneConfig.Camera); err != nil {
+			// Fields the client leaves out, like the FOV, are kept as they are
+			camera := sceneConfig.ReadCamera()
+			if err := ws.ReadJSON(&camera); err != nil {
 				return
 			}
 
+			// The VMC source may own the camera instead
+			if appConfig.VMCCamera {
+				continue
+			}
+
+			sceneConfig.WriteCamera(camera)
 			sceneConfig.Update()
 
 		}
 
 	}))
 
+	// Route for relaying the status of every receiver to all clients
+	router.HandleFunc("/live/read/receivers", webSocketMiddleware(func(ws *websocket.Conn) {
+
+		log.Println("Adding new receiver status reader client...")
+
+		defer ws.Close()
+
+		for {
+
+			if err := ws.WriteJSON(receiverStatus(receiverMap)); err != nil {
+				return
+			}
+
+			time.Sleep(statusUpdateInterval)
+
+		}
+
+	}))
+
 	// Route for updating VRM model data to all clients
 	router.HandleFunc("/live/read/model", webSocketMiddleware(func(ws *websocket.Conn) {
 
 		log.Println("Adding new model reader client...")
 
-		if err := ws.WriteJSON(activeReceiver.VRM); err != nil {
+		// On first-time connect, send the current state of the VRM
+		if err := ws.WriteJSON(active.Frame()); err != nil {
 			log.Println(err)
 			return
 		}
 
 		for {
 
-			// Process and send the VRM data to WebSocket
-			activeReceiver.VRM.Read(func(vrm *obj.VRM) {
-
-				// Send VRM data to WebSocket client
-				if err := ws.WriteJSON(*vrm); err != nil {
-					return
-				}
-
-			})
+			// Send VRM data to WebSocket client
+			if err := ws.WriteJSON(active.Frame()); err != nil {
+				return
+			}
 
 			// Wait for whatever how long, per second. By default, 1/60 of a second
 			time.Sleep(time.Duration(1e9 / appConfig.ModelUpdateFrequency))
@@ -231,7 +279,7 @@ func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map
 
 		// Set model name and CORS policy
 		w.Header().Set("Content-Disposition", "attachment; filename=default.vrm")
-		allowHTTPAllPerms(&w)
+		helper.AllowHTTPAllPerms(&w)
 
 		// Serve default VRM file
 		http.ServeFile(w, r, appConfig.VRMFilePath)
@@ -243,7 +291,7 @@ func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map
 
 		log.Println("Received request to set default VRM file")
 
-		allowHTTPAllPerms(&w)
+		helper.AllowHTTPAllPerms(&w)
 
 		// Destination VRM file on system
 		dest, err := os.Create(appConfig.VRMFilePath)
@@ -266,7 +314,7 @@ func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map
 		log.Println("Received request to save current scene")
 
 		// Access control
-		allowHTTPAllPerms(&w)
+		helper.AllowHTTPAllPerms(&w)
 
 		if err := saveSceneConfig(); err != nil {
 			log.Println(err)
@@ -279,7 +327,7 @@ func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map
 
 		log.Println("Received request to retrieve current state of scene config")
 
-		allowHTTPAllPerms(&w)
+		helper.AllowHTTPAllPerms(&w)
 
 		sceneConfigBytes, err := json.Marshal(sceneConfig)
 		if err != nil {
@@ -298,7 +346,7 @@ func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map
 		log.Println("Received request to retrieve initial config")
 
 		// Access control
-		allowHTTPAllPerms(&w)
+		helper.AllowHTTPAllPerms(&w)
 
 		// Marshal initial config into bytes
 		appConfigBytes, err := json.Marshal(appConfig)
@@ -322,7 +370,7 @@ func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map
 		for name := range receiverMap {
 			info.Available = append(info.Available, name)
 		}
-		info.Active = appConfig.Receiver
+		info.Active = active.Name()
 
 		bytes, err := json.Marshal(info)
 		if err != nil {
@@ -335,41 +383,298 @@ func New(appConfigPtr *config.App, sceneConfigPtr *config.Scene, receiverMap map
 
 	}).Methods("GET", "OPTIONS")
 
-	// Route for updating the active receiver
-	router.HandleFunc("/api/receivers", func(w http.ResponseWriter, r *http.Request) {
+	// Route for retrieving the status of every receiver, by name
+	router.HandleFunc("/api/receivers/status", func(w http.ResponseWriter, r *http.Request) {
+
+		log.Println("Received API request for receiver status")
 
-		log.Println("Received request to change the current MotionReceiver...")
+		helper.AllowHTTPAllPerms(&w)
 
-		// Read in the request body into bytes
-		reqBytes, err := io.ReadAll(r.Body)
+		bytes, err := json.Marshal(receiverStatus(receiverMap))
 		if err != nil {
 			log.Println(err)
 			return
 		}
 
-		// Unmarshal the request body bytes into JSON
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bytes)
+
+	}).Methods("GET", "OPTIONS")
+
+	// Route for updating the active receiver
+	router.HandleFunc("/api/receivers", func(w http.ResponseWriter, r *http.Request) {
+
+		log.Println("Received request to change the current receiver...")
+
+		helper.AllowHTTPAllPerms(&w)
+
+		// Read in the request body into JSON
 		var receiverInfoPayload receiver
-		json.Unmarshal(reqBytes, &receiverInfoPayload)
+		if err := json.NewDecoder(r.Body).Decode(&receiverInfoPayload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		// Error if the suggested receiver does not exist
-		if receiverMap[receiverInfoPayload.Active] == nil {
+		newReceiver, ok := receiverMap[receiverInfoPayload.Active]
+		if !ok {
 			log.Printf("Suggested receiver \"%s\" does not exist!", receiverInfoPayload.Active)
+			http.Error(w, fmt.Sprintf("receiver \"%s\" does not exist", receiverInfoPayload.Active), http.StatusNotFound)
 			return
 		}
 
-		// Stop the current receiver
-		activeReceiver.Stop()
+		// Switch the active receiver, staying with the current one if the new one fails to start
+		if err := active.Switch(context.Background(), receiverInfoPayload.Active, newReceiver); err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-		// Switch the active receiver
-		appConfig.Receiver = receiverInfoPayload.Active
-		activeReceiver = receiverMap[appConfig.Receiver]
+		log.Printf("Successfully changed the active receiver to %s", receiverInfoPayload.Active)
 
-		// Start the new receiver
-		activeReceiver.Start()
+	}).Methods("PATCH", "OPTIONS")
 
-		log.Printf("Successfully changed the active receiver to %s", appConfig.Receiver)
+	// Route for retrieving which receiver each part of the model comes from, when compositing
+	router.HandleFunc("/api/compositor", func(w http.ResponseWriter, r *http.Request) {
 
-	}).Methods("PATCH", "OPTIONS")
+		log.Println("Received API request for compositor mask")
+
+		helper.AllowHTTPAllPerms(&w)
+
+		bytes, err := json.Marshal(sceneConfig.ReadCompositor())
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bytes)
+
+	}).Methods("GET", "OPTIONS")
+
+	// Route for changing which receiver each part of the model comes from, which is also saved to the scene
+	router.HandleFunc("/api/compositor", func(w http.ResponseWriter, r *http.Request) {
+
+		log.Println("Received request to change the compositor mask")
+
+		helper.AllowHTTPAllPerms(&w)
+
+		if r.Method == http.MethodOptions {
+			return
+		}
+
+		var mask config.Compositor
+		if err := json.NewDecoder(r.Body).Decode(&mask); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := compositor.Validate(mask, receiverMap); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sceneConfig.WriteCompositor(mask)
+		sceneConfig.Update()
+
+		if err := saveSceneConfig(); err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	}).Methods("PUT", "OPTIONS")
+
+	// Route for listing every motion recording
+	router.HandleFunc("/api/recordings", func(w http.ResponseWriter, r *http.Request) {
+
+		log.Println("Received API request for recordings")
+
+		helper.AllowHTTPAllPerms(&w)
+
+		recordings, err := motionRecorder.List()
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		bytes, err := json.Marshal(recordings)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bytes)
+
+	}).Methods("GET", "OPTIONS")
+
+	// Route for starting a new motion recording
+	router.HandleFunc("/api/recordings/start", func(w http.ResponseWriter, r *http.Request) {
+
+		log.Println("Received request to start recording")
+
+		helper.AllowHTTPAllPerms(&w)
+
+		if r.Method == http.MethodOptions {
+			return
+		}
+
+		name, err := motionRecorder.Start()
+		if err == recorder.ErrRecording {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		bytes, err := json.Marshal(recording{Name: name})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bytes)
+
+	}).Methods("POST", "OPTIONS")
+
+	// Route for stopping the motion recording in progress
+	router.HandleFunc("/api/recordings/stop", func(w http.ResponseWriter, r *http.Request) {
+
+		log.Println("Received request to stop recording")
+
+		helper.AllowHTTPAllPerms(&w)
+
+		if r.Method == http.MethodOptions {
+			return
+		}
+
+		name, err := motionRecorder.Stop()
+		if err == recorder.ErrNotRecording {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		bytes, err := json.Marshal(recording{Name: name})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bytes)
+
+	}).Methods("POST", "OPTIONS")
+
+	// Route for exporting a motion recording to an animation file, e.g. "?format=vrma"
+	router.HandleFunc("/api/recordings/{name}/export", func(w http.ResponseWriter, r *http.Request) {
+
+		log.Println("Received request to export recording")
+
+		helper.AllowHTTPAllPerms(&w)
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "bvh"
+		}
+
+		exportFormat, ok := export.Formats[format]
+		if !ok {
+			http.Error(w, "unknown export format", http.StatusBadRequest)
+			return
+		}
+
+		name := mux.Vars(r)["name"]
+		recordingPath, err := motionRecorder.Path(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		recording, err := recorder.Open(recordingPath)
+		if os.IsNotExist(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Name the exported file after the recording
+		fileName := strings.TrimSuffix(name, recorder.Extension) + exportFormat.Extension
+		w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+		w.Header().Set("Content-Type", exportFormat.ContentType)
+
+		if err := exportFormat.Write(w, recording); err != nil {
+			log.Println(err)
+			return
+		}
+
+	}).Methods("GET", "OPTIONS")
+
+	// Route for playing a timeline of visemes or phonemes, e.g. from text-to-speech
+	router.HandleFunc("/api/visemes", func(w http.ResponseWriter, r *http.Request) {
+
+		log.Println("Received request to play visemes")
+
+		helper.AllowHTTPAllPerms(&w)
+
+		if r.Method == http.MethodOptions {
+			return
+		}
+
+		var timeline visemes.Timeline
+		if err := json.NewDecoder(r.Body).Decode(&timeline); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		duration, err := visemePlayer.Play(timeline)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bytes, err := json.Marshal(visemePlayback{Duration: duration})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(bytes)
+
+	}).Methods("POST", "OPTIONS")
+
+	// Route for stopping the timeline of visemes being played
+	router.HandleFunc("/api/visemes", func(w http.ResponseWriter, r *http.Request) {
+
+		log.Println("Received request to stop visemes")
+
+		helper.AllowHTTPAllPerms(&w)
+		visemePlayer.Stop()
+
+	}).Methods("DELETE")
+
+	// Routes that receivers want mounted, e.g. for browsers sending motion data
+	for _, r := range receiverMap {
+		for path, handler := range r.Routes() {
+			router.Handle(path, handler)
+		}
+	}
 
 	// All other requests are sent to the embedded web frontend
 	router.PathPrefix("/").Handler(http.FileServer(http.FS(web.Public())))
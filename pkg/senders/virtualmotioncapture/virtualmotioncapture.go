@@ -0,0 +1,160 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package virtualmotioncapture
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+	"github.com/thatpix3l/fntwo/pkg/config"
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+// Sends VRM data to other applications in the VMC protocol format, acting as a VMC "performer".
+type Sender struct {
+	AppConfig *config.App      // Pointer an existing app config, for reading various settings.
+	source    func() obj.Frame // Callback to retrieve the frame to send, e.g. the output of the active receiver
+	clients   []*osc.Client    // OSC client for each destination address
+	stop      chan struct{}    // Closed when the sender should stop sending
+}
+
+// Append a bone's position and rotation to an OSC message
+func appendBone(msg *osc.Message, bone obj.Bone) {
+
+	// Undo the rotation conversion done when the bone was written, so we send what VMC expects
+	msg.Append(
+		float32(bone.Position.X),
+		float32(bone.Position.Y),
+		float32(bone.Position.Z),
+		float32(bone.Rotation.Quaternion.X*-1),
+		float32(bone.Rotation.Quaternion.Y),
+		float32(bone.Rotation.Quaternion.Z),
+		float32(bone.Rotation.Quaternion.W),
+	)
+
+}
+
+// Build a bundle of VMC messages containing a full frame of VRM data
+func newFrame(frame obj.Frame, elapsed time.Duration) *osc.Bundle {
+
+	bundle := osc.NewBundle(time.Now())
+
+	// Tell receivers a model is loaded and available
+	bundle.Append(osc.NewMessage("/VMC/Ext/OK", int32(1)))
+	bundle.Append(osc.NewMessage("/VMC/Ext/T", float32(elapsed.Seconds())))
+
+	// Root transform of the model
+	rootMsg := osc.NewMessage("/VMC/Ext/Root/Pos", "root")
+	appendBone(rootMsg, obj.Bone{
+		Position: frame.Root.Position,
+		Rotation: frame.Root.Rotation,
+	})
+
+	// Only send scale and offset if they were changed, as not every receiver understands them
+	if frame.Root.Scale != (obj.Position{X: 1, Y: 1, Z: 1}) || frame.Root.Offset != (obj.Position{}) {
+		rootMsg.Append(
+			float32(frame.Root.Scale.X),
+			float32(frame.Root.Scale.Y),
+			float32(frame.Root.Scale.Z),
+			float32(frame.Root.Offset.X),
+			float32(frame.Root.Offset.Y),
+			float32(frame.Root.Offset.Z),
+		)
+	}
+	bundle.Append(rootMsg)
+
+	// Every bone
+	for name, bone := range frame.Bones {
+		boneMsg := osc.NewMessage("/VMC/Ext/Bone/Pos", name)
+		appendBone(boneMsg, bone)
+		bundle.Append(boneMsg)
+	}
+
+	// Every blend shape, followed by a request to apply all of them at once
+	for name, value := range frame.BlendShapes {
+		bundle.Append(osc.NewMessage("/VMC/Ext/Blend/Val", name, float32(value)))
+	}
+	bundle.Append(osc.NewMessage("/VMC/Ext/Blend/Apply"))
+
+	return bundle
+
+}
+
+// Start sending VMC data in background
+func (s *Sender) Start() error {
+
+	if s.AppConfig.VMCSendFrequency <= 0 {
+		return fmt.Errorf("VMC send frequency must be above 0, got %d", s.AppConfig.VMCSendFrequency)
+	}
+
+	for _, address := range s.AppConfig.VMCSend {
+		log.Printf("Sending VMC model transformation data to %s", address.String())
+		s.clients = append(s.clients, osc.NewClient(address.IP(), address.Port()))
+	}
+
+	go func() {
+
+		started := time.Now()
+		ticker := time.NewTicker(time.Duration(1e9 / s.AppConfig.VMCSendFrequency))
+		defer ticker.Stop()
+
+		for {
+
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+
+			// Build a frame from the current state of the VRM
+			frame := newFrame(s.source(), time.Since(started))
+
+			// Send frame to each destination
+			for _, client := range s.clients {
+				if err := client.Send(frame); err != nil {
+					log.Println(err)
+				}
+			}
+
+		}
+
+	}()
+
+	return nil
+
+}
+
+// Stop sending VMC data
+func (s *Sender) Stop() *Sender {
+	close(s.stop)
+	return s
+}
+
+// Create a new VMC sender.
+// The source callback is run every frame, to retrieve the frame to send.
+func New(appConfig *config.App, source func() obj.Frame) *Sender {
+
+	return &Sender{
+		AppConfig: appConfig,
+		source:    source,
+		stop:      make(chan struct{}),
+	}
+
+}
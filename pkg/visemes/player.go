@@ -0,0 +1,181 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package visemes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+const (
+	transition = 0.06 // Seconds to blend from one mouth shape to the next
+)
+
+// Plays timelines of mouth shapes, laid over the output on top of whatever else is moving the model
+type Player struct {
+	mutex    sync.Mutex // Guards everything below
+	steps    []step     // Timeline being played, if any
+	started  time.Time  // When the timeline started playing
+	duration float64    // Length of the timeline, in seconds
+	played   bool       // If anything was ever played, so the mouth is left closed afterwards
+}
+
+// Weights of every vowel blend shape for a mouth shape
+func (m mouth) blendShapes(amount float64) map[string]float64 {
+
+	weights := map[string]float64{
+		obj.BlendShapeA: 0,
+		obj.BlendShapeI: 0,
+		obj.BlendShapeU: 0,
+		obj.BlendShapeE: 0,
+		obj.BlendShapeO: 0,
+	}
+
+	if m.blendShape != "" {
+		weights[m.blendShape] = m.weight * amount
+	}
+
+	return weights
+
+}
+
+// Blend shapes at a given time, blending into each step from the one before it
+func blendShapesAt(steps []step, t float64) obj.BlendShapes {
+
+	blendShapes := make(obj.BlendShapes)
+	previous := closed
+	previousEnd := 0.0
+
+	for _, s := range steps {
+
+		if t < s.start || t >= s.end {
+			if t >= s.end {
+				previous = s.mouth
+				previousEnd = s.end
+			}
+			continue
+		}
+
+		// Fade in from whatever came before, unless there was a gap
+		amount := 1.0
+		if s.start-previousEnd > transition {
+			previous = closed
+		}
+		if elapsed := t - s.start; elapsed < transition {
+			amount = elapsed / transition
+		}
+
+		from := previous.blendShapes(1 - amount)
+		to := s.mouth.blendShapes(amount)
+		for name := range to {
+			blendShapes[name] = obj.BlendShape(from[name] + to[name])
+		}
+
+		return blendShapes
+
+	}
+
+	// Between steps or outside the timeline, the mouth is closed
+	for name, weight := range closed.blendShapes(1) {
+		blendShapes[name] = obj.BlendShape(weight)
+	}
+
+	return blendShapes
+
+}
+
+// Play a timeline, replacing whatever was being played.
+// Returns how long the timeline is, in seconds.
+func (p *Player) Play(timeline Timeline) (float64, error) {
+
+	steps, err := timeline.steps()
+	if err != nil {
+		return 0, err
+	}
+
+	duration := steps[len(steps)-1].end
+	for _, s := range steps {
+		if s.end > duration {
+			duration = s.end
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.steps = steps
+	p.started = time.Now()
+	p.duration = duration
+	p.played = true
+
+	return duration, nil
+
+}
+
+// Stop playing the current timeline, if any, leaving the mouth closed
+func (p *Player) Stop() {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.steps = nil
+
+}
+
+// Lay the mouth shapes of the timeline being played over a frame.
+// While playing, they replace whatever the frame has. Once stopped or done,
+// the mouth is only closed for receivers that don't move it themselves, so it isn't left open.
+func (p *Player) Overlay(frame obj.Frame) obj.Frame {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.played {
+		return frame
+	}
+
+	if p.steps != nil {
+
+		t := time.Since(p.started).Seconds()
+		if t <= p.duration {
+			for name, value := range blendShapesAt(p.steps, t) {
+				frame.BlendShapes[name] = value
+			}
+			return frame
+		}
+
+		p.steps = nil
+
+	}
+
+	for name, weight := range closed.blendShapes(1) {
+		if _, ok := frame.BlendShapes[name]; !ok {
+			frame.BlendShapes[name] = obj.BlendShape(weight)
+		}
+	}
+
+	return frame
+
+}
+
+// Create a new viseme player, which does nothing until laid over a frame
+func New() *Player {
+	return &Player{}
+}
@@ -0,0 +1,242 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package visemes
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+const (
+	lastEventDuration = 0.2 // Seconds the last event lasts, if it doesn't say
+)
+
+// Mouth shape of a single viseme or phoneme
+type mouth struct {
+	blendShape string  // VRM vowel blend shape, or empty for a closed mouth
+	weight     float64 // How far the blend shape is applied, from 0 to 1
+}
+
+// Single viseme or phoneme in a timeline
+type Event struct {
+	Time     float64 `json:"time"`     // When the event starts, relative to the start of the timeline
+	Duration float64 `json:"duration"` // How long the event lasts. Zero lasts until the next event.
+	Value    string  `json:"value"`    // Viseme or phoneme, e.g. Polly's "a", Azure's "2", ARPAbet's "AA1", or VRM's "A"
+}
+
+// Timeline of visemes or phonemes, as produced by text-to-speech engines
+type Timeline struct {
+	Delay  float64 `json:"delay"`  // Seconds to wait before starting, e.g. for audio latency
+	Units  string  `json:"units"`  // Units of event times and durations: "s" (default), "ms" or "ticks" of 100ns
+	Events []Event `json:"events"` // Every event, in any order
+}
+
+var (
+	closed = mouth{}
+
+	// VRM's own vowels, along with VRM 1.0's names for them
+	vrmVisemes = map[string]mouth{
+		"a":  {obj.BlendShapeA, 1},
+		"i":  {obj.BlendShapeI, 1},
+		"u":  {obj.BlendShapeU, 1},
+		"e":  {obj.BlendShapeE, 1},
+		"o":  {obj.BlendShapeO, 1},
+		"aa": {obj.BlendShapeA, 1},
+		"ih": {obj.BlendShapeI, 1},
+		"ou": {obj.BlendShapeU, 1},
+		"ee": {obj.BlendShapeE, 1},
+		"oh": {obj.BlendShapeO, 1},
+	}
+
+	// Amazon Polly visemes, which are case-sensitive
+	pollyVisemes = map[string]mouth{
+		"sil": closed,
+		"p":   closed,
+		"t":   {obj.BlendShapeE, 0.3},
+		"T":   {obj.BlendShapeE, 0.3},
+		"S":   {obj.BlendShapeU, 0.5},
+		"s":   {obj.BlendShapeI, 0.4},
+		"f":   {obj.BlendShapeU, 0.3},
+		"k":   {obj.BlendShapeA, 0.3},
+		"r":   {obj.BlendShapeO, 0.3},
+		"i":   {obj.BlendShapeI, 1},
+		"u":   {obj.BlendShapeU, 1},
+		"@":   {obj.BlendShapeA, 0.7},
+		"a":   {obj.BlendShapeA, 1},
+		"e":   {obj.BlendShapeE, 1},
+		"E":   {obj.BlendShapeE, 0.8},
+		"o":   {obj.BlendShapeO, 1},
+		"O":   {obj.BlendShapeO, 0.8},
+	}
+
+	// Azure Speech viseme IDs
+	azureVisemes = map[string]mouth{
+		"0":  closed,
+		"1":  {obj.BlendShapeA, 0.7},
+		"2":  {obj.BlendShapeA, 1},
+		"3":  {obj.BlendShapeO, 0.8},
+		"4":  {obj.BlendShapeE, 0.8},
+		"5":  {obj.BlendShapeE, 0.5},
+		"6":  {obj.BlendShapeI, 1},
+		"7":  {obj.BlendShapeU, 1},
+		"8":  {obj.BlendShapeO, 1},
+		"9":  {obj.BlendShapeA, 1},
+		"10": {obj.BlendShapeO, 1},
+		"11": {obj.BlendShapeA, 1},
+		"12": {obj.BlendShapeA, 0.3},
+		"13": {obj.BlendShapeO, 0.3},
+		"14": {obj.BlendShapeE, 0.3},
+		"15": {obj.BlendShapeI, 0.4},
+		"16": {obj.BlendShapeU, 0.5},
+		"17": {obj.BlendShapeE, 0.3},
+		"18": {obj.BlendShapeU, 0.3},
+		"19": {obj.BlendShapeE, 0.3},
+		"20": {obj.BlendShapeA, 0.3},
+		"21": closed,
+	}
+
+	// ARPAbet phonemes, as used by CMUdict and many English engines, without stress markers
+	arpabetPhonemes = map[string]mouth{
+		"AA": {obj.BlendShapeA, 1},
+		"AE": {obj.BlendShapeA, 0.8},
+		"AH": {obj.BlendShapeA, 0.7},
+		"AO": {obj.BlendShapeO, 1},
+		"AW": {obj.BlendShapeA, 1},
+		"AY": {obj.BlendShapeA, 1},
+		"EH": {obj.BlendShapeE, 1},
+		"ER": {obj.BlendShapeE, 0.6},
+		"EY": {obj.BlendShapeE, 1},
+		"IH": {obj.BlendShapeI, 0.8},
+		"IY": {obj.BlendShapeI, 1},
+		"OW": {obj.BlendShapeO, 1},
+		"OY": {obj.BlendShapeO, 1},
+		"UH": {obj.BlendShapeU, 0.8},
+		"UW": {obj.BlendShapeU, 1},
+		"B":  closed,
+		"M":  closed,
+		"P":  closed,
+		"F":  {obj.BlendShapeU, 0.3},
+		"V":  {obj.BlendShapeU, 0.3},
+		"W":  {obj.BlendShapeU, 0.6},
+		"CH": {obj.BlendShapeU, 0.5},
+		"JH": {obj.BlendShapeU, 0.5},
+		"SH": {obj.BlendShapeU, 0.5},
+		"ZH": {obj.BlendShapeU, 0.5},
+		"S":  {obj.BlendShapeI, 0.4},
+		"Z":  {obj.BlendShapeI, 0.4},
+		"Y":  {obj.BlendShapeI, 0.5},
+		"T":  {obj.BlendShapeE, 0.3},
+		"D":  {obj.BlendShapeE, 0.3},
+		"N":  {obj.BlendShapeE, 0.3},
+		"TH": {obj.BlendShapeE, 0.3},
+		"DH": {obj.BlendShapeE, 0.3},
+		"L":  {obj.BlendShapeE, 0.3},
+		"K":  {obj.BlendShapeA, 0.3},
+		"G":  {obj.BlendShapeA, 0.3},
+		"NG": {obj.BlendShapeA, 0.3},
+		"HH": {obj.BlendShapeA, 0.3},
+		"R":  {obj.BlendShapeO, 0.3},
+	}
+)
+
+// Mouth shape of a viseme or phoneme from any of the supported engines.
+// Polly's visemes are checked first, as they are case-sensitive and overlap with the others.
+func lookup(value string) (mouth, bool) {
+
+	if m, ok := pollyVisemes[value]; ok {
+		return m, true
+	}
+
+	if m, ok := azureVisemes[value]; ok {
+		return m, true
+	}
+
+	if m, ok := vrmVisemes[strings.ToLower(value)]; ok {
+		return m, true
+	}
+
+	if m, ok := arpabetPhonemes[strings.ToUpper(strings.TrimRight(value, "012"))]; ok {
+		return m, true
+	}
+
+	return mouth{}, false
+
+}
+
+// Single scheduled mouth shape, in seconds since the timeline started
+type step struct {
+	start float64
+	end   float64
+	mouth mouth
+}
+
+// Convert a timeline into steps, sorted and in seconds
+func (t Timeline) steps() ([]step, error) {
+
+	scale := 1.0
+	switch t.Units {
+	case "", "s":
+	case "ms":
+		scale = 1e-3
+	case "ticks":
+		scale = 1e-7
+	default:
+		return nil, fmt.Errorf("unknown units \"%s\"", t.Units)
+	}
+
+	if len(t.Events) == 0 {
+		return nil, errors.New("timeline has no events")
+	}
+
+	events := make([]Event, len(t.Events))
+	copy(events, t.Events)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time < events[j].Time
+	})
+
+	steps := make([]step, len(events))
+	for i, event := range events {
+
+		m, ok := lookup(event.Value)
+		if !ok {
+			return nil, fmt.Errorf("unknown viseme or phoneme \"%s\"", event.Value)
+		}
+
+		start := t.Delay + event.Time*scale
+		end := start + event.Duration*scale
+
+		// Without a duration, each event lasts until the next
+		if event.Duration <= 0 {
+			if i+1 < len(events) {
+				end = t.Delay + events[i+1].Time*scale
+			} else {
+				end = start + lastEventDuration
+			}
+		}
+
+		steps[i] = step{start: start, end: end, mouth: m}
+
+	}
+
+	return steps, nil
+
+}
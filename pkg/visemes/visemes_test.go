@@ -0,0 +1,225 @@
+/*
+fntwo: An easy to use tool for VTubing
+Copyright (C) 2022 thatpix3l <contact@thatpix3l.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package visemes
+
+import (
+	"math"
+	"testing"
+
+	"github.com/thatpix3l/fntwo/pkg/obj"
+)
+
+func TestSteps(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		timeline Timeline
+		steps    []step
+		wantErr  bool
+	}{
+		{
+			name: "events are sorted and last until the next",
+			timeline: Timeline{
+				Events: []Event{
+					{Time: 0.5, Value: "o"},
+					{Time: 0, Value: "a"},
+				},
+			},
+			steps: []step{
+				{start: 0, end: 0.5, mouth: mouth{obj.BlendShapeA, 1}},
+				{start: 0.5, end: 0.5 + lastEventDuration, mouth: mouth{obj.BlendShapeO, 1}},
+			},
+		},
+		{
+			name: "milliseconds with delay and duration",
+			timeline: Timeline{
+				Delay: 1,
+				Units: "ms",
+				Events: []Event{
+					{Time: 100, Duration: 50, Value: "AA1"},
+				},
+			},
+			steps: []step{
+				{start: 1.1, end: 1.15, mouth: mouth{obj.BlendShapeA, 1}},
+			},
+		},
+		{
+			name: "ticks of 100ns",
+			timeline: Timeline{
+				Units: "ticks",
+				Events: []Event{
+					{Time: 1e7, Duration: 1e6, Value: "0"},
+				},
+			},
+			steps: []step{
+				{start: 1, end: 1.1, mouth: closed},
+			},
+		},
+		{
+			name:     "no events",
+			timeline: Timeline{},
+			wantErr:  true,
+		},
+		{
+			name: "unknown units",
+			timeline: Timeline{
+				Units: "frames",
+				Events: []Event{
+					{Value: "a"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown viseme",
+			timeline: Timeline{
+				Events: []Event{
+					{Value: "nope"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			steps, err := test.timeline.steps()
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(steps) != len(test.steps) {
+				t.Fatalf("steps = %+v, want %+v", steps, test.steps)
+			}
+			for i := range steps {
+				if math.Abs(steps[i].start-test.steps[i].start) > 1e-9 ||
+					math.Abs(steps[i].end-test.steps[i].end) > 1e-9 ||
+					steps[i].mouth != test.steps[i].mouth {
+					t.Errorf("step %d = %+v, want %+v", i, steps[i], test.steps[i])
+				}
+			}
+
+		})
+	}
+
+}
+
+func TestBlendShapesAt(t *testing.T) {
+
+	steps := []step{
+		{start: 0, end: 1, mouth: mouth{obj.BlendShapeA, 1}},
+		{start: 1, end: 2, mouth: mouth{obj.BlendShapeO, 0.5}},
+		{start: 3, end: 4, mouth: mouth{obj.BlendShapeI, 1}},
+	}
+
+	tests := []struct {
+		name string
+		t    float64
+		want map[string]float64
+	}{
+		{
+			name: "fading in from closed",
+			t:    transition / 2,
+			want: map[string]float64{obj.BlendShapeA: 0.5},
+		},
+		{
+			name: "fully open",
+			t:    0.5,
+			want: map[string]float64{obj.BlendShapeA: 1},
+		},
+		{
+			name: "blending into the next step",
+			t:    1 + transition/2,
+			want: map[string]float64{obj.BlendShapeA: 0.5, obj.BlendShapeO: 0.25},
+		},
+		{
+			name: "closed between steps",
+			t:    2.5,
+			want: map[string]float64{},
+		},
+		{
+			name: "fading in after a gap starts from closed",
+			t:    3 + transition/2,
+			want: map[string]float64{obj.BlendShapeI: 0.5},
+		},
+		{
+			name: "closed after the timeline",
+			t:    5,
+			want: map[string]float64{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			blendShapes := blendShapesAt(steps, test.t)
+
+			for _, name := range []string{obj.BlendShapeA, obj.BlendShapeI, obj.BlendShapeU, obj.BlendShapeE, obj.BlendShapeO} {
+				if math.Abs(float64(blendShapes[name])-test.want[name]) > 1e-9 {
+					t.Errorf("%s = %v, want %v", name, blendShapes[name], test.want[name])
+				}
+			}
+
+		})
+	}
+
+}
+
+func TestOverlay(t *testing.T) {
+
+	frame := func() obj.Frame {
+		return obj.Frame{
+			BlendShapes: obj.BlendShapes{
+				obj.BlendShapeA:     0.8,
+				obj.BlendShapeBlink: 1,
+			},
+		}
+	}
+
+	p := New()
+
+	// Nothing is laid over the frame before anything is played
+	if got := p.Overlay(frame()); len(got.BlendShapes) != 2 {
+		t.Errorf("before playing, blend shapes = %v", got.BlendShapes)
+	}
+
+	if _, err := p.Play(Timeline{Events: []Event{{Duration: 10, Value: "o"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// While playing, every vowel is replaced
+	got := p.Overlay(frame())
+	if got.BlendShapes[obj.BlendShapeA] != 0 || got.BlendShapes[obj.BlendShapeBlink] != 1 {
+		t.Errorf("while playing, blend shapes = %v", got.BlendShapes)
+	}
+
+	// Once stopped, the mouth is closed, except for vowels the receiver moves itself
+	p.Stop()
+	got = p.Overlay(frame())
+	if got.BlendShapes[obj.BlendShapeA] != 0.8 || got.BlendShapes[obj.BlendShapeO] != 0 || len(got.BlendShapes) != 6 {
+		t.Errorf("after stopping, blend shapes = %v", got.BlendShapes)
+	}
+
+}